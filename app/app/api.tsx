@@ -15,7 +15,7 @@ export const getDir = async (path: string) => {
 }
 
 export const remove = async (path: string) => {
-  url.pathname = `_api${path}`
+  url.pathname = `_api/file${path}`
   const response = await fetch(url, {
     method: 'DELETE',
   })
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/prxg22/git-drive/internal/config"
 	"github.com/prxg22/git-drive/internal/handlers"
 	"github.com/prxg22/git-drive/internal/services"
 	"github.com/prxg22/git-drive/pkg/git"
@@ -13,44 +21,312 @@ import (
 )
 
 func main() {
-	var _port, _privateKey, _pass, _fileServerPath, _owner, _repo, _remote, _path string
+	var _insecureHostKey bool
+	var _knownHosts, _fingerprints, _config, _watch, _pull, _coalesce, _diverge, _hookSecretFile, _hookSecretEnv, _shutdown, _sign, _signKey, _signPass string
+	var _port, _privateKey, _pass, _authMethod, _user, _secretFile, _secretEnv, _fileServerPath, _owner, _repo, _url, _remote, _branch, _path, _hidden, _ignorePolicy, _quotas, _state string
 
 	// get config from flags
+	flag.StringVar(&_config, "config", "", "JSON file declaring the drives to serve. overrides the single drive flags")
 	flag.StringVar(&_port, "port", ":8080", "server port to listen. default :8080")
 	flag.StringVar(&_privateKey, "key", "", "ssh private key path")
 	flag.StringVar(&_pass, "pwd", "", "ssh private key password. optional")
+	flag.StringVar(&_authMethod, "auth", "ssh", "remote auth method: \"ssh\", \"basic\", \"token\" or \"none\". default \"ssh\"")
+	flag.StringVar(&_knownHosts, "known-hosts", "", "known_hosts file verifying the remote's ssh host key. default ~/.ssh/known_hosts")
+	flag.StringVar(&_fingerprints, "host-fingerprints", "", "comma separated SHA256 fingerprints pinning the remote's ssh host key. optional")
+	flag.BoolVar(&_insecureHostKey, "insecure-host-key", false, "accept any ssh host key. never use it against untrusted networks")
+	flag.StringVar(&_sign, "sign", "", "commit signing method: \"openpgp\" or \"ssh\". commits are unsigned by default")
+	flag.StringVar(&_signKey, "sign-key", "", "private key path signing the commits: armored OpenPGP or ssh")
+	flag.StringVar(&_signPass, "sign-pwd", "", "signing key passphrase. optional")
+	flag.StringVar(&_user, "user", "", "username for basic and token auth")
+	flag.StringVar(&_secretFile, "secret-file", "", "file holding the password or token for basic and token auth")
+	flag.StringVar(&_secretEnv, "secret-env", "GIT_DRIVE_SECRET", "environment variable holding the password or token when -secret-file is not set. default \"GIT_DRIVE_SECRET\"")
 	flag.StringVar(&_fileServerPath, "static", "./app/build/client", "path in whichthe static files are located. default \"./public\"")
 	flag.StringVar(&_owner, "owner", "", "repo's owner")
 	flag.StringVar(&_repo, "repo", "", "repo's name")
+	flag.StringVar(&_url, "url", "", "remote repository url: ssh, https, file:// or a local path. overrides owner and repo")
 	flag.StringVar(&_remote, "remote", "origin", "repo's remote name")
+	flag.StringVar(&_branch, "branch", "", "working branch cloned, pulled and pushed. default the remote's HEAD")
 	flag.StringVar(&_path, "path", "/"+_repo, "local path in which repo will be cloned")
+	flag.StringVar(&_hidden, "hidden", "", "comma separated gitignore-style patterns hidden from listings. optional")
+	flag.StringVar(&_ignorePolicy, "ignored", "reject", "policy for mutations on ignored paths: \"reject\" or \"force\". default \"reject\"")
+	flag.StringVar(&_quotas, "quotas", "", "path of a JSON file with drive and user quotas. optional")
+	flag.StringVar(&_state, "state", "./.git-drive", "directory in which server state such as stars is kept. default \"./.git-drive\"")
+	flag.StringVar(&_watch, "watch", "", "debounce for committing changes made directly in the worktree, e.g. 2s. disabled by default")
+	flag.StringVar(&_pull, "pull", "", "interval between fetches of the remote, e.g. 1m. default 30s")
+	flag.StringVar(&_coalesce, "coalesce", "", "window in which a user's changes are merged into one commit, e.g. 5s. disabled by default")
+	flag.StringVar(&_diverge, "diverge", "merge", "strategy when local and remote history diverge: \"merge\" or \"rebase\". default \"merge\"")
+	flag.StringVar(&_hookSecretFile, "hook-secret-file", "", "file holding the secret verifying push webhooks. webhooks are rejected without a secret")
+	flag.StringVar(&_hookSecretEnv, "hook-secret-env", "GIT_DRIVE_HOOK_SECRET", "environment variable holding the webhook secret when -hook-secret-file is not set. default \"GIT_DRIVE_HOOK_SECRET\"")
+	flag.StringVar(&_shutdown, "shutdown", "30s", "deadline for committing and pushing the pending changes on SIGTERM. default 30s")
 	flag.Parse()
 
-	if _privateKey == "" || _owner == "" || _repo == "" {
-		log.Fatalf("missing config: path (%v), owner (%v), repo (%v)", _privateKey, _owner, _repo)
+	grace, err := time.ParseDuration(_shutdown)
+	if err != nil || grace <= 0 {
+		log.Fatalf("invalid shutdown deadline \"%v\"", _shutdown)
 	}
 
-	// initiate git storage
-	auth, err := ssh.NewPublicKeysFromFile("git", _privateKey, _pass)
-	if err != nil {
-		log.Fatal(fmt.Errorf("failed getting keys on path \"%v\": \n%w", _privateKey, err))
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	var drives []config.Drive
+
+	if _config != "" {
+		c, err := config.Load(_config, _state)
+		if err != nil {
+			log.Fatal(err)
+		}
+		drives = c.Drives
+	} else {
+		d := config.Drive{
+			Name:     "default",
+			URL:      _url,
+			Owner:    _owner,
+			Repo:     _repo,
+			Remote:   _remote,
+			Branch:   _branch,
+			Path:     _path,
+			Ignored:  _ignorePolicy,
+			Quotas:   _quotas,
+			State:    _state,
+			Watch:    _watch,
+			Pull:     _pull,
+			Coalesce: _coalesce,
+			Diverge:  _diverge,
+			Hook: config.Hook{
+				SecretFile: _hookSecretFile,
+				SecretEnv:  _hookSecretEnv,
+			},
+			Signing: config.Signing{
+				Method:     _sign,
+				Key:        _signKey,
+				Passphrase: _signPass,
+			},
+			Auth: config.Auth{
+				Method:          _authMethod,
+				User:            _user,
+				Key:             _privateKey,
+				Password:        _pass,
+				SecretFile:      _secretFile,
+				SecretEnv:       _secretEnv,
+				KnownHosts:      _knownHosts,
+				InsecureHostKey: _insecureHostKey,
+			},
+		}
+
+		if _hidden != "" {
+			d.Hidden = strings.Split(_hidden, ",")
+		}
+
+		if _fingerprints != "" {
+			d.Auth.Fingerprints = strings.Split(_fingerprints, ",")
+		}
 
-	gc := git.NewGitClient(_owner, _repo, _remote, _path, auth)
-	gfs := git.NewGitFileSystem(gc)
-	gds := services.NewGitDriveService(gfs)
+		if err := d.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		drives = []config.Drive{d}
+	}
 
 	// initiate routes and server
 	routes := make(spaserver.Routes)
-
-	handler := handlers.DirHandler{Service: gds}
 	routes["OPTIONS /{dir...}"] = handlers.Options
-	routes["GET /dir/{dir...}"] = handler.ReadDir
-	routes["GET /dir"] = handler.ReadDir
-	routes["DELETE /{path...}"] = handler.Remove
-	routes["GET /operations/{id}"] = handler.GetOperations
+
+	dhs := make(handlers.Drives)
+	opened := openDrives(drives)
+
+	for i, d := range drives {
+		gds := opened[i]
+		handler := &handlers.DirHandler{Service: gds, Closing: ctx.Done()}
+		dhs[d.Name] = handler
+
+		// the first drive is also served on the API root
+		if i == 0 {
+			for p, h := range handler.Routes() {
+				routes[p] = h
+			}
+		} else {
+			gds.SharePrefix = path.Join("/_api/drives", d.Name, "shared") + "/"
+		}
+	}
+
+	for p, h := range dhs.Routes() {
+		routes[p] = h
+	}
 
 	s := spaserver.NewSPAServer(&routes, "/_api", _fileServerPath)
 	log.Printf("listening on port %v\n", _port)
-	s.Listen(_port)
+
+	shutdown, cancel := deadline(ctx, grace)
+	defer cancel()
+
+	err = s.Listen(ctx, shutdown, _port)
+
+	if err != nil {
+		log.Println(err)
+		// no signal will come if the server could not listen, so the grace period starts now
+		stop()
+	}
+
+	closeDrives(shutdown, opened)
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// deadline returns a context done grace after ctx is, so every step of the shutdown shares the same grace period.
+func deadline(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	shutdown, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-shutdown.Done():
+			return
+		}
+
+		select {
+		case <-time.After(grace):
+			cancel()
+		case <-shutdown.Done():
+		}
+	}()
+
+	return shutdown, cancel
+}
+
+// openDrives opens every drive concurrently, as cloning one can take a while, and exits if any of them fails.
+// The services are returned in the order of drives.
+func openDrives(drives []config.Drive) []*services.Service {
+	opened := make([]*services.Service, len(drives))
+	errs := make([]error, len(drives))
+
+	var wg sync.WaitGroup
+
+	for i, d := range drives {
+		wg.Add(1)
+
+		go func(i int, d config.Drive) {
+			defer wg.Done()
+
+			opened[i], errs[i] = openDrive(d)
+		}(i, d)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to open drive \"%v\": %w", drives[i].Name, err))
+		}
+	}
+
+	return opened
+}
+
+// closeDrives commits and pushes the pending changes of every drive, giving up once ctx is done.
+// Commits left unpushed are kept in the drive's journal and pushed on the next start.
+func closeDrives(ctx context.Context, drives []*services.Service) {
+	var wg sync.WaitGroup
+
+	for _, gds := range drives {
+		wg.Add(1)
+
+		go func(gds *services.Service) {
+			defer wg.Done()
+
+			if err := gds.Close(ctx); err != nil {
+				log.Println(fmt.Errorf("failed to close drive at \"%v\": %w", gds.GFS.Path, err))
+			}
+		}(gds)
+	}
+
+	wg.Wait()
+}
+
+// openDrive clones or opens the drive's repository and starts its processing loop.
+func openDrive(d config.Drive) (*services.Service, error) {
+	ac, err := d.AuthConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := ac.AuthMethod()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := d.SigningConfig().Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := git.ParseIgnorePolicy(d.Ignored)
+	if err != nil {
+		return nil, err
+	}
+
+	strategy, err := git.ParseDivergeStrategy(d.Diverge)
+	if err != nil {
+		return nil, err
+	}
+
+	watch, err := d.WatchInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	pull, err := d.PullInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	coalesce, err := d.CoalesceWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	url := d.URL
+	if url == "" {
+		url = git.GitHubURL(d.Owner, d.Repo, auth)
+	}
+
+	gc, err := git.NewGitClient(url, d.Remote, d.Branch, d.Path, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	gc.SignWith(signer)
+	gc.PullEvery(pull)
+	gc.CoalesceWithin(coalesce)
+	gc.DivergeWith(strategy)
+	gfs := git.NewGitFileSystem(gc, d.Hidden, policy)
+
+	if watch > 0 {
+		if err := gc.Watch(watch); err != nil {
+			return nil, err
+		}
+	}
+
+	quotas, err := services.LoadQuotas(d.Quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	hookSecret, err := d.HookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	gds, err := services.NewGitDriveService(gfs, quotas, d.State)
+	if err != nil {
+		return nil, err
+	}
+
+	if hookSecret != "" {
+		gds.HookSecret = []byte(hookSecret)
+	}
+
+	return gds, nil
 }
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+// Auth holds the credentials of a drive's remote.
+type Auth struct {
+	Method          string   `json:"method"`     // "ssh", "basic", "token" or "none". Defaults to "ssh".
+	User            string   `json:"user"`       // username of basic and token auth
+	Key             string   `json:"key"`        // ssh private key path
+	Password        string   `json:"password"`   // ssh private key password
+	SecretFile      string   `json:"secretFile"` // file holding the password or token of basic and token auth
+	SecretEnv       string   `json:"secretEnv"`  // environment variable holding it when SecretFile is empty
+	KnownHosts      string   `json:"knownHosts"`
+	Fingerprints    []string `json:"fingerprints"`
+	InsecureHostKey bool     `json:"insecureHostKey"`
+}
+
+// Signing configures the key the server signs its commits with.
+type Signing struct {
+	Method     string `json:"method"` // "openpgp", "ssh" or empty for unsigned commits
+	Key        string `json:"key"`    // private key path
+	Passphrase string `json:"passphrase"`
+}
+
+// Hook configures the secret verifying push webhooks.
+type Hook struct {
+	SecretFile string `json:"secretFile"` // file holding the webhook secret
+	SecretEnv  string `json:"secretEnv"`  // environment variable holding it when SecretFile is empty
+}
+
+// Drive configures one repository served by the server.
+type Drive struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`   // remote url; when empty, Owner and Repo name a GitHub repository
+	Owner    string   `json:"owner"` // GitHub shorthand
+	Repo     string   `json:"repo"`  // GitHub shorthand
+	Remote   string   `json:"remote"`
+	Branch   string   `json:"branch"` // working branch; empty keeps the branch the clone is on
+	Path     string   `json:"path"`   // local clone
+	Auth     Auth     `json:"auth"`
+	Signing  Signing  `json:"signing"`
+	Hook     Hook     `json:"hook"`
+	Hidden   []string `json:"hidden"`
+	Ignored  string   `json:"ignored"`  // ignore policy, "reject" or "force"
+	Quotas   string   `json:"quotas"`   // quotas file
+	State    string   `json:"state"`    // state directory; defaults to the server's state directory joined with Name
+	Watch    string   `json:"watch"`    // worktree watcher debounce, e.g. "2s"; empty disables it
+	Pull     string   `json:"pull"`     // interval between fetches of the remote, e.g. "30s"; empty uses the default
+	Coalesce string   `json:"coalesce"` // window merging a user's changes into one commit, e.g. "5s"; empty commits every change
+	Diverge  string   `json:"diverge"`  // divergence strategy, "merge" or "rebase"
+}
+
+type Config struct {
+	Drives []Drive `json:"drives"`
+}
+
+// Load reads a JSON config file, filling defaults from state, the server's state directory.
+func Load(file, state string) (*Config, error) {
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config \"%v\": %w", file, err)
+	}
+
+	c := &Config{}
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse config \"%v\": %w", file, err)
+	}
+
+	if len(c.Drives) == 0 {
+		return nil, fmt.Errorf("config \"%v\" declares no drive", file)
+	}
+
+	names := map[string]bool{}
+	paths := map[string]string{}
+
+	for i := range c.Drives {
+		d := &c.Drives[i]
+
+		if d.Name == "" || d.Name != path.Base(path.Join("/", d.Name)) {
+			return nil, fmt.Errorf("drive %d has an invalid name \"%v\"", i, d.Name)
+		}
+
+		if names[d.Name] {
+			return nil, fmt.Errorf("drive \"%v\" is declared twice", d.Name)
+		}
+		names[d.Name] = true
+
+		if d.State == "" {
+			d.State = path.Join(state, d.Name)
+		}
+
+		if err := d.Validate(); err != nil {
+			return nil, err
+		}
+
+		// a clone inside another drive's worktree would be committed by that drive
+		for p, other := range paths {
+			if nested(p, path.Clean(d.Path)) {
+				return nil, fmt.Errorf("drive \"%v\" shares its path \"%v\" with drive \"%v\"", d.Name, d.Path, other)
+			}
+		}
+		paths[path.Clean(d.Path)] = d.Name
+	}
+
+	return c, nil
+}
+
+// nested reports whether two paths are the same or one is inside the other.
+func nested(a, b string) bool {
+	return a == b || strings.HasPrefix(a, strings.TrimSuffix(b, "/")+"/") || strings.HasPrefix(b, strings.TrimSuffix(a, "/")+"/")
+}
+
+// Validate checks the drive has a remote, a local path, a valid pull interval and coalescing window, and defaults its remote name.
+func (d *Drive) Validate() error {
+	if d.URL == "" && (d.Owner == "" || d.Repo == "") {
+		return fmt.Errorf("drive \"%v\" is missing config: url (%v) or owner (%v) and repo (%v)", d.Name, d.URL, d.Owner, d.Repo)
+	}
+
+	if d.Path == "" {
+		return fmt.Errorf("drive \"%v\" is missing its local path", d.Name)
+	}
+
+	if d.Remote == "" {
+		d.Remote = "origin"
+	}
+
+	if _, err := d.PullInterval(); err != nil {
+		return fmt.Errorf("drive \"%v\" has an invalid pull interval: %w", d.Name, err)
+	}
+
+	if _, err := d.CoalesceWindow(); err != nil {
+		return fmt.Errorf("drive \"%v\" has an invalid coalescing window: %w", d.Name, err)
+	}
+
+	return nil
+}
+
+// AuthConfig reads the drive's credential and returns its git authentication config.
+func (d *Drive) AuthConfig() (git.AuthConfig, error) {
+	a := d.Auth
+	secret := a.Password
+
+	if a.Method != "" && a.Method != git.AUTH_SSH {
+		var err error
+
+		if secret, err = git.ReadSecret(a.SecretFile, a.SecretEnv); err != nil {
+			return git.AuthConfig{}, err
+		}
+	}
+
+	return git.AuthConfig{
+		Method: a.Method,
+		User:   a.User,
+		Key:    a.Key,
+		Secret: secret,
+		HostKeyConfig: git.HostKeyConfig{
+			KnownHosts:   a.KnownHosts,
+			Fingerprints: a.Fingerprints,
+			Insecure:     a.InsecureHostKey,
+		},
+	}, nil
+}
+
+// SigningConfig builds the commit signing configuration of the drive.
+func (d *Drive) SigningConfig() git.SigningConfig {
+	return git.SigningConfig{Method: d.Signing.Method, Key: d.Signing.Key, Secret: d.Signing.Passphrase}
+}
+
+// HookSecret reads the drive's webhook secret. Empty means webhooks are rejected.
+func (d *Drive) HookSecret() (string, error) {
+	return git.ReadSecret(d.Hook.SecretFile, d.Hook.SecretEnv)
+}
+
+// WatchInterval parses the drive's watcher debounce. Zero disables the watcher.
+func (d *Drive) WatchInterval() (time.Duration, error) {
+	if d.Watch == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(d.Watch)
+}
+
+// PullInterval parses the drive's fetch interval, defaulting to git.PULL_INTERVAL.
+func (d *Drive) PullInterval() (time.Duration, error) {
+	if d.Pull == "" {
+		return git.PULL_INTERVAL, nil
+	}
+
+	interval, err := time.ParseDuration(d.Pull)
+
+	if err == nil && interval <= 0 {
+		err = fmt.Errorf("\"%v\" is not positive", d.Pull)
+	}
+
+	return interval, err
+}
+
+// CoalesceWindow parses the drive's coalescing window. Zero commits every change on its own.
+func (d *Drive) CoalesceWindow() (time.Duration, error) {
+	if d.Coalesce == "" {
+		return 0, nil
+	}
+
+	window, err := time.ParseDuration(d.Coalesce)
+
+	if err == nil && window < 0 {
+		err = fmt.Errorf("\"%v\" is negative", d.Coalesce)
+	}
+
+	return window, err
+}
@@ -0,0 +1,70 @@
+package config_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/prxg22/git-drive/internal/config"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	file := path.Join(t.TempDir(), "drives.json")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return file
+}
+
+func TestLoadDefaults(t *testing.T) {
+	file := writeConfig(t, `{"drives": [
+		{"name": "docs", "url": "file:///srv/docs.git", "path": "/var/docs"},
+		{"name": "media", "owner": "prxg22", "repo": "media", "path": "/var/media", "remote": "upstream"}
+	]}`)
+
+	c, err := config.Load(file, "/state")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(c.Drives) != 2 {
+		t.Fatalf("Expected 2 drives, got %v", len(c.Drives))
+	}
+
+	if d := c.Drives[0]; d.Remote != "origin" || d.State != "/state/docs" {
+		t.Errorf("Expected default remote and state, got %v and %v", d.Remote, d.State)
+	}
+
+	if d := c.Drives[1]; d.Remote != "upstream" {
+		t.Errorf("Expected remote upstream, got %v", d.Remote)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, content := range []string{
+		`{"drives": []}`,
+		`{"drives": [{"name": "docs", "path": "/var/docs"}]}`,
+		`{"drives": [{"name": "docs", "url": "file:///srv/docs.git", "path": "/var/docs", "pull": "0s"}]}`,
+		`{"drives": [{"name": "docs", "url": "file:///srv/docs.git", "path": "/var/docs", "coalesce": "-1s"}]}`,
+		`{"drives": [{"name": "../docs", "url": "file:///srv/docs.git", "path": "/var/docs"}]}`,
+		`{"drives": [
+			{"name": "docs", "url": "file:///srv/docs.git", "path": "/var/docs"},
+			{"name": "docs", "url": "file:///srv/other.git", "path": "/var/other"}
+		]}`,
+		`{"drives": [
+			{"name": "docs", "url": "file:///srv/docs.git", "path": "/var/docs"},
+			{"name": "other", "url": "file:///srv/other.git", "path": "/var/docs/"}
+		]}`,
+		`{"drives": [
+			{"name": "docs", "url": "file:///srv/docs.git", "path": "/var/docs"},
+			{"name": "other", "url": "file:///srv/other.git", "path": "/var/docs/other"}
+		]}`,
+	} {
+		if _, err := config.Load(writeConfig(t, content), "/state"); err == nil {
+			t.Errorf("Expected error loading %v", content)
+		}
+	}
+}
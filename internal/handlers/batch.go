@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+func (dh *DirHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if upload, err := dh.Service.Upload(requestUser(r), r.Body); err == nil {
+		writeJSON(w, upload)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	var steps []services.BatchStep
+
+	if err := json.NewDecoder(r.Body).Decode(&steps); err != nil {
+		writeError(w, fmt.Errorf("failed to decode batch: %v: %w", err, services.ErrInvalidRequest))
+		return
+	}
+
+	if op, err := dh.Service.Batch(requestUser(r), steps); err == nil {
+		writeJSON(w, op)
+	} else {
+		writeError(w, err)
+	}
+}
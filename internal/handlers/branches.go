@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+type branchRequest struct {
+	Name string `json:"name"`
+}
+
+func (dh *DirHandler) Branches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if branches, err := dh.Service.Branches(); err == nil {
+		writeJSON(w, branches)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) CreateBranch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	var req branchRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("failed to decode branch: %v: %w", err, services.ErrInvalidRequest))
+		return
+	}
+
+	if branch, err := dh.Service.CreateBranch(requestUser(r), req.Name); err == nil {
+		writeJSON(w, branch)
+	} else {
+		writeError(w, err)
+	}
+}
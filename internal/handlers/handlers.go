@@ -2,35 +2,83 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/prxg22/git-drive/internal/services"
+	"github.com/prxg22/git-drive/pkg/git"
 )
 
 type DirHandler struct {
 	Service services.GitDriveService
+	Closing <-chan struct{} // Closing is closed when the server shuts down, ending the progress streams.
+}
+
+// errorStatus maps the errors returned by the service to an HTTP status code.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, git.ErrIgnoredPath):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidRequest), errors.Is(err, git.ErrUnknownStep), errors.Is(err, fs.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUnauthenticated), errors.Is(err, services.ErrSharePassword), errors.Is(err, services.ErrHookSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrShareExpired):
+		return http.StatusGone
+	case errors.Is(err, services.ErrShareNotFound), errors.Is(err, services.ErrDriveNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, git.ErrLocked):
+		return http.StatusLocked
+	case errors.Is(err, git.ErrNotLocked), errors.Is(err, fs.ErrExist), errors.Is(err, git.ErrUnresolvedDivergence), errors.Is(err, git.ErrNotCancellable):
+		return http.StatusConflict
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, git.ErrStale):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, services.ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, git.ErrClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func Options(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 	w.Header().Add("Access-Control-Allow-Methods", "*")
+	w.Header().Add("Access-Control-Allow-Headers", "*")
 	w.WriteHeader(200)
 	w.Write([]byte(""))
 }
 
 func (dh *DirHandler) ReadDir(w http.ResponseWriter, r *http.Request) {
 	dir := r.PathValue("dir")
+	all := r.URL.Query().Get("all") == "true"
 
-	files, err := dh.Service.ReadDir(dir)
+	var files []services.FileInfo
+	var err error
+
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		files, err = dh.Service.ReadDirAt(ref, dir, all)
+	} else {
+		files, err = dh.Service.ReadDir(dir, all)
+	}
 
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		log.Println(err)
 		w.Write([]byte(err.Error()))
 		return
@@ -52,12 +100,12 @@ func (dh *DirHandler) Remove(w http.ResponseWriter, r *http.Request) {
 	path := path.Clean(r.PathValue("path"))
 	w.Header().Add("Access-Control-Allow-Origin", "*")
 
-	op, err := dh.Service.Remove(path)
+	op, err := dh.Service.Remove(requestUser(r), path)
 
 	if err != nil {
 		log.Println(err)
 
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		w.Write([]byte(err.Error()))
 		return
 	}
@@ -74,6 +122,99 @@ func (dh *DirHandler) Remove(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, v any) {
+	if res, err := json.Marshal(v); err == nil {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(res)
+	} else {
+		writeError(w, err)
+	}
+}
+
+// writeError logs err and responds with its message and matching status code.
+func writeError(w http.ResponseWriter, err error) {
+	log.Println(err)
+	w.WriteHeader(errorStatus(err))
+	w.Write([]byte(err.Error()))
+}
+
+func (dh *DirHandler) Quota(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if report, err := dh.Service.Quota(requestUser(r)); err == nil {
+		writeJSON(w, report)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) Download(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		content, info, err := dh.Service.OpenAt(ref, r.PathValue("path"))
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+		return
+	}
+
+	f, info, err := dh.Service.Open(requestUser(r), r.PathValue("path"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	if hash, err := dh.Service.Hash(r.PathValue("path")); err == nil {
+		w.Header().Set("ETag", `"`+hash+`"`)
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// Write overwrites an existing file. The If-Match header must hold the blob hash the client loaded,
+// as served in the ETag of Download. On a mismatch it responds 412 with the current hash.
+func (dh *DirHandler) Write(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Access-Control-Expose-Headers", "ETag")
+
+	hash := strings.Trim(strings.TrimPrefix(r.Header.Get("If-Match"), "W/"), `"`)
+
+	op, hash, err := dh.Service.Write(requestUser(r), r.PathValue("path"), hash, r.Body)
+
+	var stale *git.StaleError
+	if errors.As(err, &stale) {
+		w.Header().Set("ETag", `"`+stale.Current+`"`)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hash+`"`)
+	writeJSON(w, op)
+}
+
+// Restore brings the file or folder back to its content at the revision given by ?ref=.
+func (dh *DirHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if op, err := dh.Service.Restore(requestUser(r), r.PathValue("path"), r.URL.Query().Get("ref")); err == nil {
+		writeJSON(w, op)
+	} else {
+		writeError(w, err)
+	}
+}
+
 func (dh *DirHandler) GetOperations(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 
@@ -123,10 +264,29 @@ func (dh *DirHandler) GetOperations(w http.ResponseWriter, r *http.Request) {
 	// 	}
 	// }
 
-	checkProgress(w, r, c)
+	checkProgress(w, r, c, dh.Closing)
+}
+
+// CancelOperation undoes an operation that was not pushed yet, such as from an "Undo" toast shown until the push.
+func (dh *DirHandler) CancelOperation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+
+	if err != nil {
+		writeError(w, fmt.Errorf("invalid operation id: %v: %w", err, services.ErrInvalidRequest))
+		return
+	}
+
+	if err := dh.Service.CancelOperation(requestUser(r), id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func checkProgress(w http.ResponseWriter, r *http.Request, c chan *services.Operation) {
+func checkProgress(w http.ResponseWriter, r *http.Request, c chan *services.Operation, closing <-chan struct{}) {
 	ok := true
 	for ok {
 		select {
@@ -147,8 +307,35 @@ func checkProgress(w http.ResponseWriter, r *http.Request, c chan *services.Oper
 			} else {
 				return
 			}
+		case <-closing:
+			// the client sees the stream end instead of a dropped connection and may reconnect after restart
+			fmt.Fprintf(w, "event: close\n\n")
+			fmt.Fprintf(w, "data: close\n\n")
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return
 		case <-r.Context().Done():
 			return
 		}
 	}
 }
+
+// Sync fetches the remote immediately and responds once the drive is up to date with it.
+func (dh *DirHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if err := dh.Service.Sync(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Status reports whether the drive reaches its remote. Offline, mutations still succeed and are pushed later.
+func (dh *DirHandler) Status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	writeJSON(w, dh.Service.Status())
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+func (dh *DirHandler) History(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if entries, err := dh.Service.History(r.PathValue("path")); err == nil {
+		writeJSON(w, entries)
+	} else {
+		writeError(w, err)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+// HOOK_MAX_SIZE caps the size of a webhook payload.
+const HOOK_MAX_SIZE = 1 << 20
+
+// pushHook reads the provider, event and signature of a webhook delivery from its headers.
+func pushHook(r *http.Request) services.PushHook {
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "":
+		return services.PushHook{Provider: services.HOOK_GITEA, Event: r.Header.Get("X-Gitea-Event"), Signature: r.Header.Get("X-Gitea-Signature")}
+	case r.Header.Get("X-Gitlab-Event") != "":
+		return services.PushHook{Provider: services.HOOK_GITLAB, Event: r.Header.Get("X-Gitlab-Event"), Signature: r.Header.Get("X-Gitlab-Token")}
+	default:
+		return services.PushHook{Provider: services.HOOK_GITHUB, Event: r.Header.Get("X-GitHub-Event"), Signature: r.Header.Get("X-Hub-Signature-256")}
+	}
+}
+
+// PushHook receives GitHub, Gitea and GitLab push webhooks. A verified push to the drive's branch
+// triggers a fetch and responds 202; other deliveries respond 200 with the reason they were ignored.
+func (dh *DirHandler) PushHook(w http.ResponseWriter, r *http.Request) {
+	h := pushHook(r)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, HOOK_MAX_SIZE))
+
+	if err != nil {
+		writeError(w, fmt.Errorf("failed to read webhook: %v: %w", err, services.ErrInvalidRequest))
+		return
+	}
+
+	h.Body = body
+	res, err := dh.Service.PushHook(h)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !res.Synced {
+		writeJSON(w, res)
+		return
+	}
+
+	b, err := json.Marshal(res)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(b)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+func (dh *DirHandler) Lock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if lock, err := dh.Service.Lock(requestUser(r), r.PathValue("path")); err == nil {
+		writeJSON(w, lock)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if err := dh.Service.Unlock(requestUser(r), r.PathValue("path")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (dh *DirHandler) Locks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if locks, err := dh.Service.Locks(); err == nil {
+		writeJSON(w, locks)
+	} else {
+		writeError(w, err)
+	}
+}
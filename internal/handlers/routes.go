@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+type route = func(dh *DirHandler, w http.ResponseWriter, r *http.Request)
+
+// ROUTES maps the patterns of a drive's API to their handlers.
+// Routes taking a file path nest it under a fixed prefix, so paths such as "stars/x" never reach another route.
+// "DELETE /{path...}" predates the /file prefix and is kept for existing clients; paths shadowed by a more
+// specific route, such as "stars/x", can only be removed through "DELETE /file/{path...}".
+var ROUTES = map[string]route{
+	"GET /dir/{dir...}":              (*DirHandler).ReadDir,
+	"GET /dir":                       (*DirHandler).ReadDir,
+	"DELETE /file/{path...}":         (*DirHandler).Remove,
+	"DELETE /{path...}":              (*DirHandler).Remove,
+	"GET /operations/{id}":           (*DirHandler).GetOperations,
+	"DELETE /operations/{id}":        (*DirHandler).CancelOperation,
+	"GET /quota":                     (*DirHandler).Quota,
+	"GET /file/{path...}":            (*DirHandler).Download,
+	"PUT /file/{path...}":            (*DirHandler).Write,
+	"POST /restore/{path...}":        (*DirHandler).Restore,
+	"PUT /stars/{path...}":           (*DirHandler).Star,
+	"DELETE /stars/{path...}":        (*DirHandler).Unstar,
+	"GET /stars":                     (*DirHandler).Stars,
+	"GET /recent":                    (*DirHandler).Recent,
+	"POST /uploads":                  (*DirHandler).Upload,
+	"POST /batch":                    (*DirHandler).Batch,
+	"POST /locks/{path...}":          (*DirHandler).Lock,
+	"DELETE /locks/{path...}":        (*DirHandler).Unlock,
+	"GET /locks":                     (*DirHandler).Locks,
+	"POST /shares":                   (*DirHandler).CreateShare,
+	"GET /shares":                    (*DirHandler).Shares,
+	"DELETE /shares/{id}":            (*DirHandler).RevokeShare,
+	"GET /shared/{token}":            (*DirHandler).Shared,
+	"GET /shared/{token}/{path...}":  (*DirHandler).Shared,
+	"POST /shared/{token}":           (*DirHandler).Shared,
+	"POST /shared/{token}/{path...}": (*DirHandler).Shared,
+	"GET /branches":                  (*DirHandler).Branches,
+	"POST /branches":                 (*DirHandler).CreateBranch,
+	"GET /history":                   (*DirHandler).History,
+	"GET /history/{path...}":         (*DirHandler).History,
+	"POST /sync":                     (*DirHandler).Sync,
+	"GET /status":                    (*DirHandler).Status,
+	"POST /hooks/push":               (*DirHandler).PushHook,
+}
+
+// Routes binds the drive's API to dh.
+func (dh *DirHandler) Routes() map[string]http.HandlerFunc {
+	routes := make(map[string]http.HandlerFunc, len(ROUTES))
+
+	for p, h := range ROUTES {
+		routes[p] = func(w http.ResponseWriter, r *http.Request) { h(dh, w, r) }
+	}
+
+	return routes
+}
+
+// Drives holds the handler of every drive by name.
+type Drives map[string]*DirHandler
+
+type DriveInfo struct {
+	Name string `json:"name"`
+}
+
+// Routes mounts every drive's API under /drives/{drive} and lists the drives on GET /drives.
+func (ds Drives) Routes() map[string]http.HandlerFunc {
+	routes := map[string]http.HandlerFunc{"GET /drives": ds.List}
+
+	for p, h := range ROUTES {
+		method, pattern, _ := strings.Cut(p, " ")
+		routes[method+" /drives/{drive}"+pattern] = func(w http.ResponseWriter, r *http.Request) {
+			dh, ok := ds[r.PathValue("drive")]
+
+			if !ok {
+				w.Header().Add("Access-Control-Allow-Origin", "*")
+				writeError(w, fmt.Errorf("drive \"%v\": %w", r.PathValue("drive"), services.ErrDriveNotFound))
+				return
+			}
+
+			h(dh, w, r)
+		}
+	}
+
+	return routes
+}
+
+func (ds Drives) List(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	drives := make([]DriveInfo, 0, len(ds))
+
+	for name := range ds {
+		drives = append(drives, DriveInfo{name})
+	}
+
+	slices.SortFunc(drives, func(a, b DriveInfo) int { return strings.Compare(a.Name, b.Name) })
+
+	writeJSON(w, drives)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+// SHARE_PASSWORD_HEADER carries the password of a protected share link.
+const SHARE_PASSWORD_HEADER = "X-Share-Password"
+
+func (dh *DirHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	var req services.ShareRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("failed to decode share: %v: %w", err, services.ErrInvalidRequest))
+		return
+	}
+
+	if share, err := dh.Service.CreateShare(requestUser(r), req); err == nil {
+		writeJSON(w, share)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) Shares(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if shares, err := dh.Service.Shares(requestUser(r)); err == nil {
+		writeJSON(w, shares)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if err := dh.Service.RevokeShare(requestUser(r), r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Shared is the public route of share links. It needs no user identity, only a valid token.
+// The password of a protected link is read from the SHARE_PASSWORD_HEADER header, or from the "password" field
+// of a POST form, never from the URL where logs and browser history would keep it.
+// Every request serving the first byte of a file counts as a download, see servesStart.
+func (dh *DirHandler) Shared(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	password := r.Header.Get(SHARE_PASSWORD_HEADER)
+	if password == "" && r.Method == http.MethodPost {
+		password = r.PostFormValue("password")
+	}
+
+	count := func(size int64) bool { return servesStart(r, size) }
+
+	content, err := dh.Service.OpenShare(r.PathValue("token"), r.PathValue("path"), password, count)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if content.Content == nil {
+		writeJSON(w, content.Files)
+		return
+	}
+
+	if c, ok := content.Content.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	http.ServeContent(w, r, content.Name, content.ModTime, content.Content)
+}
+
+// servesStart reports whether http.ServeContent answers r with the first byte of content of the given size.
+// It follows the rules ServeContent applies to the Range header: a suffix range covering the whole content,
+// or ranges adding up to more than it, serve it all. A header it cannot parse, or an If-Range condition,
+// is counted too rather than trusted.
+func servesStart(r *http.Request, size int64) bool {
+	rng := r.Header.Get("Range")
+
+	if r.Method == http.MethodHead {
+		return false
+	}
+
+	if rng == "" || r.Header.Get("If-Range") != "" || size == 0 {
+		return true
+	}
+
+	specs, ok := strings.CutPrefix(rng, "bytes=")
+
+	if !ok {
+		return true
+	}
+
+	var sum int64
+
+	for _, spec := range strings.Split(specs, ",") {
+		spec = textproto.TrimString(spec)
+
+		if spec == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+
+		if !ok {
+			return true
+		}
+
+		first, last = textproto.TrimString(first), textproto.TrimString(last)
+
+		if first == "" {
+			// a suffix range serves the last bytes, all of them if it is longer than the content
+			n, err := strconv.ParseInt(last, 10, 64)
+
+			if err != nil || n < 0 {
+				return true
+			}
+
+			if n >= size {
+				return true
+			}
+
+			sum += n
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+
+		if err != nil || start < 0 {
+			return true
+		}
+
+		if start == 0 {
+			return true
+		}
+
+		if start >= size {
+			continue
+		}
+
+		end := size - 1
+
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return true
+			}
+
+			end = min(end, size-1)
+		}
+
+		sum += end - start + 1
+	}
+
+	// ServeContent ignores ranges adding up to more than the content and sends it whole
+	return sum > size
+}
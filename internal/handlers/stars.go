@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+func (dh *DirHandler) Star(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if err := dh.Service.Star(requestUser(r), r.PathValue("path")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (dh *DirHandler) Unstar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if err := dh.Service.Unstar(requestUser(r), r.PathValue("path")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (dh *DirHandler) Stars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if files, err := dh.Service.Stars(requestUser(r)); err == nil {
+		writeJSON(w, files)
+	} else {
+		writeError(w, err)
+	}
+}
+
+func (dh *DirHandler) Recent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if files, err := dh.Service.Recent(requestUser(r)); err == nil {
+		writeJSON(w, files)
+	} else {
+		writeError(w, err)
+	}
+}
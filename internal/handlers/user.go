@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+// Headers set by the authenticating proxy in front of the server.
+const USER_HEADER = "X-Forwarded-User"
+const EMAIL_HEADER = "X-Forwarded-Email"
+
+func requestUser(r *http.Request) services.User {
+	return services.User{
+		Name:  r.Header.Get(USER_HEADER),
+		Email: r.Header.Get(EMAIL_HEADER),
+	}
+}
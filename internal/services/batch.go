@@ -0,0 +1,189 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+// BatchStep is a mutation of a batch request. Writes refer to content staged with Upload.
+type BatchStep struct {
+	Op     string `json:"op"`
+	Path   string `json:"path"`
+	To     string `json:"to,omitempty"`
+	Upload string `json:"upload,omitempty"`
+}
+
+// UPLOAD_TTL is how long staged content waits for a batch before it is discarded.
+const UPLOAD_TTL = 24 * time.Hour
+
+type Upload struct {
+	Id   string `json:"id"`
+	Size int64  `json:"size"`
+}
+
+func (gds *Service) uploadsDir() string {
+	return path.Join(gds.state, "uploads")
+}
+
+// uploadPath is where the upload id of u is staged. Uploads are kept per uploader, so only u can write them.
+func (gds *Service) uploadPath(u User, id string) string {
+	owner := sha256.Sum256([]byte(u.Email))
+
+	return path.Join(gds.uploadsDir(), hex.EncodeToString(owner[:]), path.Base(path.Join("/", id)))
+}
+
+// Upload stages content in the state directory so a later batch of u can write it into the drive within UPLOAD_TTL.
+// Content that would not fit in the drive's or u's quota fails with ErrQuotaExceeded.
+func (gds *Service) Upload(u User, content io.Reader) (*Upload, error) {
+	if err := gds.expireUploads(); err != nil {
+		log.Println(err)
+	}
+
+	room, err := gds.room(u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if room >= 0 {
+		// one more byte tells content that fills the room exactly from content that does not fit
+		content = io.LimitReader(content, room+1)
+	}
+
+	id, err := randomString(12)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := gds.uploadPath(u, id)
+
+	if err := os.MkdirAll(path.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := io.Copy(f, content)
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(p)
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
+	}
+
+	if room >= 0 && size > room {
+		os.Remove(p)
+		return nil, fmt.Errorf("upload %w", ErrQuotaExceeded)
+	}
+
+	return &Upload{id, size}, nil
+}
+
+// expireUploads removes the uploads staged longer than UPLOAD_TTL ago.
+func (gds *Service) expireUploads() error {
+	err := filepath.WalkDir(gds.uploadsDir(), func(fp string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > UPLOAD_TTL {
+			return os.Remove(fp)
+		}
+
+		return nil
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to expire uploads: %w", err)
+	}
+
+	return nil
+}
+
+// openUpload returns the staged file of upload id of u, failing with fs.ErrNotExist once it expired.
+func (gds *Service) openUpload(u User, id string) (string, fs.FileInfo, error) {
+	p := gds.uploadPath(u, id)
+	info, err := os.Stat(p)
+
+	if err != nil {
+		return "", nil, fmt.Errorf("upload %v: %w", id, err)
+	}
+
+	if time.Since(info.ModTime()) > UPLOAD_TTL {
+		os.Remove(p)
+		return "", nil, fmt.Errorf("upload %v expired: %w", id, fs.ErrNotExist)
+	}
+
+	return p, info, nil
+}
+
+// Batch applies every step or none of them, as a single commit.
+// Locks and quotas are checked for all steps before the worktree is touched, and stars follow the steps once applied.
+func (gds *Service) Batch(u User, steps []BatchStep) (*Operation, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty batch: %w", ErrInvalidRequest)
+	}
+
+	gsteps := make([]git.Step, len(steps))
+
+	for i, s := range steps {
+		gsteps[i] = git.Step{Op: s.Op, Path: s.Path, To: s.To}
+
+		if s.Op == "write" {
+			if s.Upload == "" {
+				return nil, fmt.Errorf("write of \"%v\" has no upload: %w", s.Path, ErrInvalidRequest)
+			}
+
+			source, _, err := gds.openUpload(u, s.Upload)
+
+			if err != nil {
+				return nil, err
+			}
+
+			gsteps[i].Source = source
+		}
+	}
+
+	id, err := gds.GFS.Batch(gsteps, u.author(), gds.quota(u))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range steps {
+		var err error
+
+		switch s.Op {
+		case "move":
+			err = gds.renameStars(s.Path, s.To)
+		case "remove":
+			err = gds.dropStars(s.Path)
+		case "write":
+			err = os.Remove(gds.uploadPath(u, s.Upload))
+		}
+
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	return gds.track(id, 'b'), nil
+}
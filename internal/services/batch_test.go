@@ -0,0 +1,64 @@
+package services_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+func TestBatchUploads(t *testing.T) {
+	gds, state := newService(t, map[string]string{"a.txt": "a"}, nil)
+
+	upload, err := gds.Upload(alice, strings.NewReader("content"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	steps := []services.BatchStep{{Op: "write", Path: "b.txt", Upload: upload.Id}}
+
+	if _, err := gds.Batch(bob, steps); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected another user's upload not to exist, got %v", err)
+	}
+
+	op, err := gds.Batch(alice, steps)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if op.Id < 0 {
+		t.Errorf("Expected an operation, got %+v", op)
+	}
+	if b, _ := os.ReadFile(path.Join(gds.GFS.Path, "b.txt")); string(b) != "content" {
+		t.Errorf("Expected the uploaded content, got %q", b)
+	}
+
+	upload, err = gds.Upload(alice, strings.NewReader("late"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	staged, _ := filepath.Glob(path.Join(state, "uploads", "*", upload.Id))
+	if len(staged) != 1 {
+		t.Fatalf("Expected the upload to be staged, got %v", staged)
+	}
+
+	old := time.Now().Add(-services.UPLOAD_TTL - time.Minute)
+	if err := os.Chtimes(staged[0], old, old); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	steps = []services.BatchStep{{Op: "write", Path: "c.txt", Upload: upload.Id}}
+
+	if _, err := gds.Batch(alice, steps); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the expired upload not to exist, got %v", err)
+	}
+	if _, err := os.Stat(staged[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the expired upload to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+// Branches lists the drive's branches, flagging the working one.
+func (gds *Service) Branches() ([]git.Branch, error) {
+	return gds.GFS.Processor.Branches()
+}
+
+// CreateBranch creates a branch from the drive's current state. The drive keeps working on its branch.
+func (gds *Service) CreateBranch(u User, name string) (*git.Branch, error) {
+	if u.Anonymous() {
+		return nil, ErrUnauthenticated
+	}
+
+	return gds.GFS.Processor.CreateBranch(name)
+}
+
+// ReadDirAt lists the directory path as it is on ref, a branch or commit, read from the object store.
+// Entries are filtered like ReadDir's.
+func (gds *Service) ReadDirAt(ref, path string, all bool) ([]FileInfo, error) {
+	infos, err := gds.GFS.ReadDirAt(ref, path, all)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]FileInfo, len(infos))
+
+	for i, f := range infos {
+		files[i] = FileInfo{Name: f.Name(), IsDir: f.IsDir(), Size: float64(f.Size()) / 1280}
+	}
+
+	return files, nil
+}
+
+// OpenAt returns the content of the file path as it is on ref, a branch or commit, read from the object store.
+func (gds *Service) OpenAt(ref, path string) (io.ReadSeeker, fs.FileInfo, error) {
+	b, info, err := gds.GFS.OpenAt(ref, path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bytes.NewReader(b), info, nil
+}
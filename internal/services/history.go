@@ -0,0 +1,11 @@
+package services
+
+import "github.com/prxg22/git-drive/pkg/git"
+
+// HISTORY_MAX_SIZE is the maximum number of commits returned by History.
+const HISTORY_MAX_SIZE = 100
+
+// History lists the newest commits that changed path, with whether each one was signed by the server.
+func (gds *Service) History(path string) ([]git.HistoryEntry, error) {
+	return gds.GFS.Processor.History(path, HISTORY_MAX_SIZE)
+}
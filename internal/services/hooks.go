@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+var ErrHookSignature = errors.New("webhook signature mismatch")
+
+// Providers whose push webhooks are accepted.
+const (
+	HOOK_GITHUB = "github"
+	HOOK_GITEA  = "gitea"
+	HOOK_GITLAB = "gitlab"
+)
+
+// PushHook is a webhook delivery as received from a provider.
+type PushHook struct {
+	Provider  string // Provider is one of HOOK_GITHUB, HOOK_GITEA or HOOK_GITLAB.
+	Event     string // Event is the provider's event name, e.g. "push" or "Push Hook".
+	Signature string // Signature is the HMAC of the body, or GitLab's secret token.
+	Body      []byte
+}
+
+type HookResult struct {
+	Synced bool   `json:"synced"`
+	Reason string `json:"reason,omitempty"` // Reason tells why a delivery was ignored.
+}
+
+// pushPayload holds the fields of the GitHub, Gitea and GitLab push payloads that identify the pushed branch.
+type pushPayload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+		URL      string `json:"url"`
+		GitHTTP  string `json:"git_http_url"`
+		GitSSH   string `json:"git_ssh_url"`
+		Homepage string `json:"homepage"`
+	} `json:"repository"`
+	Project struct {
+		GitHTTP string `json:"git_http_url"`
+		GitSSH  string `json:"git_ssh_url"`
+		WebURL  string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (p *pushPayload) urls() []string {
+	r := p.Repository
+	return []string{r.CloneURL, r.SSHURL, r.HTMLURL, r.URL, r.GitHTTP, r.GitSSH, r.Homepage, p.Project.GitHTTP, p.Project.GitSSH, p.Project.WebURL}
+}
+
+// verify checks the delivery against the drive's hook secret.
+// GitHub and Gitea sign the body with HMAC-SHA256; GitLab sends the secret itself as a token.
+func (h *PushHook) verify(secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("no webhook secret configured: %w", ErrHookSignature)
+	}
+
+	if h.Provider == HOOK_GITLAB {
+		if !hmac.Equal([]byte(h.Signature), secret) {
+			return ErrHookSignature
+		}
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(h.Body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(strings.TrimPrefix(h.Signature, "sha256=")), []byte(expected)) {
+		return ErrHookSignature
+	}
+
+	return nil
+}
+
+// normalizeRemote reduces a remote URL to host and path, so the ssh, https and web URLs of a repository compare equal.
+func normalizeRemote(u string) string {
+	u = strings.TrimSpace(strings.ToLower(u))
+
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		u = parsed.Hostname() + "/" + strings.TrimPrefix(parsed.Path, "/")
+	} else if at := strings.Index(u, "@"); at >= 0 && strings.Contains(u[at:], ":") {
+		// scp-like ssh, e.g. git@github.com:owner/repo.git
+		host, p, _ := strings.Cut(u[at+1:], ":")
+		u = host + "/" + p
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+}
+
+// PushHook verifies a push webhook and, if it is about the drive's remote and working branch,
+// fetches the remote in the background. Other events and branches are acknowledged but ignored.
+func (gds *Service) PushHook(h PushHook) (*HookResult, error) {
+	if err := h.verify(gds.HookSecret); err != nil {
+		return nil, err
+	}
+
+	if e := strings.ToLower(h.Event); e != "push" && e != "push hook" {
+		return &HookResult{Reason: fmt.Sprintf("event \"%v\" is not a push", h.Event)}, nil
+	}
+
+	var payload pushPayload
+
+	if err := json.Unmarshal(h.Body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse push payload: %v: %w", err, ErrInvalidRequest)
+	}
+
+	gc := gds.GFS.Processor
+	remote := normalizeRemote(gc.URL())
+	matches := false
+
+	for _, u := range payload.urls() {
+		if u != "" && normalizeRemote(u) == remote {
+			matches = true
+			break
+		}
+	}
+
+	if !matches {
+		return &HookResult{Reason: "push is for another repository"}, nil
+	}
+
+	if branch := gc.Branch(); payload.Ref != "refs/heads/"+branch {
+		return &HookResult{Reason: fmt.Sprintf("push is for \"%v\", not the drive's branch \"%v\"", payload.Ref, branch)}, nil
+	}
+
+	go func() {
+		if err := gds.Sync(); err != nil {
+			log.Println(fmt.Errorf("failed to sync on push webhook: %w", err))
+		}
+	}()
+
+	return &HookResult{Synced: true}, nil
+}
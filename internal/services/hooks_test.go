@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/prxg22/git-drive/internal/services"
+	"github.com/prxg22/git-drive/internal/testutil"
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+var hookSecret = []byte("hook-secret")
+
+// newHookService creates a drive service whose client reports remote as its URL,
+// while its clone still fetches from a local bare repository.
+func newHookService(t *testing.T, remote string) *services.Service {
+	t.Helper()
+
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+	local := testutil.LocalPath(t)
+
+	if _, err := gogit.PlainClone(local, false, &gogit.CloneOptions{URL: url}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gc, err := git.NewGitClient(remote, "origin", "", local, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gc.PullEvery(time.Hour)
+
+	gds, err := services.NewGitDriveService(git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT), &services.Quotas{}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gds.HookSecret = hookSecret
+
+	return gds
+}
+
+func sign(secret []byte, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestPushHook(t *testing.T) {
+	gds := newHookService(t, "ssh://git@git.invalid:22/Owner/Repo.git")
+	ref := "refs/heads/" + gds.GFS.Processor.Branch()
+
+	github := func(repository string) string {
+		return fmt.Sprintf(`{"ref": %q, "repository": {%v}}`, ref, repository)
+	}
+	gitlab := fmt.Sprintf(`{"ref": %q, "project": {"git_ssh_url": "git@git.invalid:owner/repo.git"}}`, ref)
+	other := `{"ref": "refs/heads/other", "repository": {"clone_url": "https://git.invalid/owner/repo.git"}}`
+
+	tests := []struct {
+		name   string
+		secret []byte
+		hook   services.PushHook
+		synced bool
+		err    error
+	}{
+		{
+			name:   "github https clone url",
+			hook:   services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Body: []byte(github(`"clone_url": "https://git.invalid/owner/repo.git"`))},
+			synced: true,
+		},
+		{
+			name:   "github scp-like ssh url",
+			hook:   services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Body: []byte(github(`"ssh_url": "git@git.invalid:Owner/Repo.git"`))},
+			synced: true,
+		},
+		{
+			name:   "github web url without .git",
+			hook:   services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Body: []byte(github(`"html_url": "https://git.invalid/owner/repo/"`))},
+			synced: true,
+		},
+		{
+			name:   "gitea",
+			hook:   services.PushHook{Provider: services.HOOK_GITEA, Event: "push", Body: []byte(github(`"clone_url": "https://git.invalid/owner/repo.git"`))},
+			synced: true,
+		},
+		{
+			name:   "gitlab token",
+			hook:   services.PushHook{Provider: services.HOOK_GITLAB, Event: "Push Hook", Signature: string(hookSecret), Body: []byte(gitlab)},
+			synced: true,
+		},
+		{
+			name: "github wrong signature",
+			hook: services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Signature: sign([]byte("wrong"), github("")), Body: []byte(github(""))},
+			err:  services.ErrHookSignature,
+		},
+		{
+			name: "gitlab wrong token",
+			hook: services.PushHook{Provider: services.HOOK_GITLAB, Event: "Push Hook", Signature: "wrong", Body: []byte(gitlab)},
+			err:  services.ErrHookSignature,
+		},
+		{
+			name:   "no secret configured",
+			secret: []byte{},
+			hook:   services.PushHook{Provider: services.HOOK_GITLAB, Event: "Push Hook", Body: []byte(gitlab)},
+			err:    services.ErrHookSignature,
+		},
+		{
+			name: "not a push",
+			hook: services.PushHook{Provider: services.HOOK_GITHUB, Event: "issues", Body: []byte(github(`"clone_url": "https://git.invalid/owner/repo.git"`))},
+		},
+		{
+			name: "wrong branch",
+			hook: services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Body: []byte(other)},
+		},
+		{
+			name: "another repository",
+			hook: services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Body: []byte(github(`"clone_url": "https://git.invalid/owner/other.git"`))},
+		},
+		{
+			name: "invalid payload",
+			hook: services.PushHook{Provider: services.HOOK_GITHUB, Event: "push", Body: []byte("{")},
+			err:  services.ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gds.HookSecret = hookSecret
+			if tt.secret != nil {
+				gds.HookSecret = tt.secret
+			}
+
+			if tt.hook.Signature == "" && tt.hook.Provider != services.HOOK_GITLAB {
+				tt.hook.Signature = sign(hookSecret, string(tt.hook.Body))
+			}
+
+			res, err := gds.PushHook(tt.hook)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if res.Synced != tt.synced {
+				t.Errorf("Expected synced to be %v, got %+v", tt.synced, res)
+			}
+			if !res.Synced && res.Reason == "" {
+				t.Errorf("Expected an ignored delivery to have a reason, got %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Limit bounds the storage of a drive or user. Zero values mean unlimited.
+type Limit struct {
+	Size  int64 `json:"size"`  // Size in bytes.
+	Files int64 `json:"files"` // Number of files.
+}
+
+// Quotas holds the drive limit, the default per-user limit and per-user overrides keyed by email.
+type Quotas struct {
+	Drive Limit            `json:"drive"`
+	User  Limit            `json:"user"`
+	Users map[string]Limit `json:"users"`
+}
+
+type QuotaUsage struct {
+	Usage git.Usage `json:"usage"`
+	Limit Limit     `json:"limit"`
+}
+
+type QuotaReport struct {
+	Drive QuotaUsage  `json:"drive"`
+	User  *QuotaUsage `json:"user,omitempty"`
+}
+
+// LoadQuotas reads the quota configuration from a JSON file.
+// An empty path returns unlimited quotas.
+func LoadQuotas(path string) (*Quotas, error) {
+	q := &Quotas{Users: map[string]Limit{}}
+
+	if path == "" {
+		return q, nil
+	}
+
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quotas \"%v\": %w", path, err)
+	}
+
+	if err := json.Unmarshal(b, q); err != nil {
+		return nil, fmt.Errorf("failed to parse quotas \"%v\": %w", path, err)
+	}
+
+	return q, nil
+}
+
+func (q *Quotas) limit(u User) Limit {
+	if l, ok := q.Users[u.Email]; ok {
+		return l
+	}
+
+	return q.User
+}
+
+func (l Limit) allows(u git.Usage) bool {
+	return (l.Size == 0 || u.Size <= l.Size) && (l.Files == 0 || u.Files <= l.Files)
+}
+
+func (gds *Service) Quota(u User) (*QuotaReport, error) {
+	total, authors, err := gds.GFS.Processor.Usage()
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &QuotaReport{Drive: QuotaUsage{total, gds.Quotas.Drive}}
+
+	if !u.Anonymous() {
+		report.User = &QuotaUsage{authors[u.Email], gds.Quotas.limit(u)}
+	}
+
+	return report, nil
+}
+
+// room returns how many bytes u may still add before going over the drive's or the user's size limit,
+// or -1 if neither limits the size.
+func (gds *Service) room(u User) (int64, error) {
+	total, authors, err := gds.GFS.Processor.Usage()
+
+	if err != nil {
+		return 0, err
+	}
+
+	room := int64(-1)
+
+	if l := gds.Quotas.Drive.Size; l != 0 {
+		room = max(l-total.Size, 0)
+	}
+
+	if l := gds.Quotas.limit(u).Size; l != 0 && !u.Anonymous() {
+		if left := max(l-authors[u.Email].Size, 0); room < 0 || left < room {
+			room = left
+		}
+	}
+
+	return room, nil
+}
+
+// quota returns the check of the changes of u, which fails with ErrQuotaExceeded if adding their delta to the usage,
+// including the changes not committed yet, would go over the drive's or the user's limit.
+// Mutations that add content pass it to the file system, which runs it along with the change.
+func (gds *Service) quota(u User) git.QuotaCheck {
+	return func(delta, total git.Usage, authors map[string]git.Usage) error {
+		if !gds.Quotas.Drive.allows(total.Add(delta)) {
+			return fmt.Errorf("drive %w", ErrQuotaExceeded)
+		}
+
+		if !u.Anonymous() && !gds.Quotas.limit(u).allows(authors[u.Email].Add(delta)) {
+			return fmt.Errorf("user %v %w", u.Email, ErrQuotaExceeded)
+		}
+
+		return nil
+	}
+}
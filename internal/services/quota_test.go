@@ -0,0 +1,140 @@
+package services_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+func TestUploadQuota(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "a"}, &services.Quotas{User: services.Limit{Size: 10}})
+
+	if _, err := gds.Upload(alice, strings.NewReader("more than ten bytes")); !errors.Is(err, services.ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+
+	upload, err := gds.Upload(alice, strings.NewReader("ten bytes!"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if upload.Size != 10 {
+		t.Errorf("Expected 10 bytes, got %v", upload.Size)
+	}
+}
+
+func TestQuotaPending(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "a"}, &services.Quotas{User: services.Limit{Size: 8}})
+	gds.GFS.Processor.CoalesceWithin(time.Hour)
+
+	hash, err := gds.Hash("a.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, _, err := gds.Write(alice, "a.txt", hash, strings.NewReader("hello")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report, err := gds.Quota(alice)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.User.Usage.Size != 5 || report.User.Usage.Files != 1 {
+		t.Errorf("Expected the uncommitted write to be charged to alice, got %+v", report.User.Usage)
+	}
+	if report.Drive.Usage.Size != 5 || report.Drive.Usage.Files != 1 {
+		t.Errorf("Expected the drive usage to include the uncommitted write, got %+v", report.Drive.Usage)
+	}
+
+	hash, _ = gds.Hash("a.txt")
+
+	if _, _, err := gds.Write(alice, "a.txt", hash, strings.NewReader("123456789")); !errors.Is(err, services.ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestQuotaConcurrentWrites(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "a"}, &services.Quotas{User: services.Limit{Size: 10}})
+
+	uploads := make([]*services.Upload, 4)
+
+	for i := range uploads {
+		upload, err := gds.Upload(alice, strings.NewReader("6bytes"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		uploads[i] = upload
+	}
+
+	errs := make(chan error, len(uploads))
+	var wg sync.WaitGroup
+
+	for i, upload := range uploads {
+		wg.Add(1)
+
+		go func(i int, upload *services.Upload) {
+			defer wg.Done()
+
+			_, err := gds.Batch(alice, []services.BatchStep{{Op: "write", Path: fmt.Sprintf("f%d.txt", i), Upload: upload.Id}})
+			errs <- err
+		}(i, upload)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	written := 0
+
+	for err := range errs {
+		if err == nil {
+			written++
+		} else if !errors.Is(err, services.ErrQuotaExceeded) {
+			t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+		}
+	}
+
+	if written != 1 {
+		t.Errorf("Expected 1 write to fit in the quota, got %v", written)
+	}
+
+	report, err := gds.Quota(alice)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.User.Usage.Size != 6 {
+		t.Errorf("Expected alice to use 6 bytes, got %+v", report.User.Usage)
+	}
+}
+
+func TestRestoreQuota(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "0123456789"}, &services.Quotas{User: services.Limit{Size: 8}})
+
+	seed, err := gds.GFS.Processor.ResolveRevision("HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	hash, _ := gds.Hash("a.txt")
+
+	if _, _, err := gds.Write(alice, "a.txt", hash, strings.NewReader("ab")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := gds.Restore(alice, "a.txt", seed); !errors.Is(err, services.ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if b, _ := os.ReadFile(path.Join(gds.GFS.Path, "a.txt")); string(b) != "ab" {
+		t.Errorf("Expected the file to be left as it was, got %q", b)
+	}
+
+	if _, err := gds.Restore(bob, "a.txt", seed); err != nil {
+		t.Errorf("Expected the restore to fit in bob's quota, got %v", err)
+	}
+}
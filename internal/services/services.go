@@ -1,21 +1,70 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
 	"strings"
 
 	"github.com/prxg22/git-drive/pkg/git"
 )
 
+var ErrInvalidRequest = errors.New("invalid request")
+var ErrDriveNotFound = errors.New("drive not found")
+var ErrPreconditionRequired = errors.New("If-Match with the file's blob hash is required")
+
+// OPERATIONS_MAX_SIZE is the number of operations whose kind is remembered, matching the finished operations the journal keeps.
+const OPERATIONS_MAX_SIZE = git.JOURNAL_MAX_DONE
+
 type GitDriveService interface {
-	ReadDir(path string) ([]FileInfo, error)
-	Remove(path string) (*Operation, error)
+	ReadDir(path string, all bool) ([]FileInfo, error)
+	Remove(u User, path string) (*Operation, error)
 	ListeOperation(id int64) (chan *Operation, error)
+	CancelOperation(u User, id int64) error
+	Quota(u User) (*QuotaReport, error)
+	Open(u User, path string) (*os.File, fs.FileInfo, error)
+	Write(u User, path, hash string, content io.Reader) (*Operation, string, error)
+	Restore(u User, path, ref string) (*Operation, error)
+	Hash(path string) (string, error)
+	Lock(u User, path string) (*git.Lock, error)
+	Unlock(u User, path string) error
+	Locks() ([]git.Lock, error)
+	Star(u User, path string) error
+	Unstar(u User, path string) error
+	Stars(u User) ([]StarredFile, error)
+	Recent(u User) ([]RecentFile, error)
+	CreateShare(u User, req ShareRequest) (*Share, error)
+	Shares(u User) ([]Share, error)
+	RevokeShare(u User, id string) error
+	OpenShare(token, sub, password string, count func(size int64) bool) (*SharedContent, error)
+	Upload(u User, content io.Reader) (*Upload, error)
+	Batch(u User, steps []BatchStep) (*Operation, error)
+	Branches() ([]git.Branch, error)
+	CreateBranch(u User, name string) (*git.Branch, error)
+	ReadDirAt(ref, path string, all bool) ([]FileInfo, error)
+	OpenAt(ref, path string) (io.ReadSeeker, fs.FileInfo, error)
+	History(path string) ([]git.HistoryEntry, error)
+	Sync() error
+	Status() git.RemoteStatus
+	Close(ctx context.Context) error
+	PushHook(h PushHook) (*HookResult, error)
 }
 
 type Service struct {
-	GFS *git.GitFileSystem
-	ops map[int64]*Operation
+	GFS         *git.GitFileSystem
+	Quotas      *Quotas
+	SharePrefix string                          // SharePrefix is the route under which the drive serves share links.
+	HookSecret  []byte                          // HookSecret verifies push webhooks; without it they are rejected.
+	ops         *store[map[int64]byte]          // kind of the last OPERATIONS_MAX_SIZE operations, by id
+	starred     *store[map[string][]string]     // starred paths per user email
+	downloads   *store[map[string][]RecentFile] // downloads log per user email
+	shares      *store[map[string]Share]        // share links by id
+	secret      []byte                          // HMAC key signing share links
+	state       string                          // directory of the server's state
 }
 
 type FileInfo struct {
@@ -26,22 +75,58 @@ type FileInfo struct {
 }
 
 type Operation struct {
-	Id       int64  `json:"id"`
-	Op       byte   `json:"op"`
-	Progress uint32 `json:"progress"`
-	Status   string `json:"status"`
-	Data     string `json:"data"`
+	Id        int64          `json:"id"`
+	Op        byte           `json:"op"`
+	Progress  uint32         `json:"progress"`
+	Status    string         `json:"status"`
+	Data      string         `json:"data"`
+	Hash      string         `json:"hash,omitempty"` // Hash of the commit holding the change, once committed.
+	Conflicts []git.Conflict `json:"conflicts,omitempty"`
 }
 
-func NewGitDriveService(gfs *git.GitFileSystem) *Service {
+// NewGitDriveService creates the drive service. Per-user data is persisted in the state directory.
+func NewGitDriveService(gfs *git.GitFileSystem, quotas *Quotas, state string) (*Service, error) {
+	starred, err := openStore(state, "stars.json", map[string][]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	downloads, err := openStore(state, "downloads.json", map[string][]RecentFile{})
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := openStore(state, "shares.json", map[string]Share{})
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := openStore(state, "operations.json", map[int64]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := loadSecret(state)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Service{
 		gfs,
-		make(map[int64]*Operation),
-	}
+		quotas,
+		SHARE_PREFIX,
+		nil,
+		ops,
+		starred,
+		downloads,
+		shares,
+		secret,
+		state,
+	}, nil
 }
 
-func (gds *Service) ReadDir(path string) ([]FileInfo, error) {
-	if f, err := gds.GFS.ReadDir(strings.TrimSpace(path)); err == nil {
+func (gds *Service) ReadDir(path string, all bool) ([]FileInfo, error) {
+	if f, err := gds.GFS.ReadDir(strings.TrimSpace(path), all); err == nil {
 		files := make([]FileInfo, len(f))
 
 		for i, file := range f {
@@ -54,17 +139,48 @@ func (gds *Service) ReadDir(path string) ([]FileInfo, error) {
 	}
 }
 
-func (gds *Service) Remove(path string) (*Operation, error) {
-	if id, err := gds.GFS.Remove(path); err == nil {
-		op := &Operation{
-			id,
-			'r',
-			0,
-			"pending",
-			"",
+func (gds *Service) track(id int64, kind byte) *Operation {
+	op := &Operation{
+		id,
+		kind,
+		0,
+		"pending",
+		"",
+		"",
+		nil,
+	}
+
+	err := gds.ops.update(func(ops *map[int64]byte) error {
+		(*ops)[id] = kind
+
+		if len(*ops) > OPERATIONS_MAX_SIZE {
+			oldest := id
+
+			for k := range *ops {
+				oldest = min(oldest, k)
+			}
+
+			delete(*ops, oldest)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Println(fmt.Errorf("failed to record operation %d: %w", id, err))
+	}
+
+	return op
+}
+
+func (gds *Service) Remove(u User, path string) (*Operation, error) {
+	if id, err := gds.GFS.Remove(path, u.author()); err == nil {
+		op := gds.track(id, 'r')
+
+		if err := gds.dropStars(path); err != nil {
+			log.Println(err)
 		}
 
-		gds.ops[id] = op
 		return op, nil
 	} else {
 		return nil, err
@@ -72,24 +188,128 @@ func (gds *Service) Remove(path string) (*Operation, error) {
 
 }
 
+func (gds *Service) Open(u User, path string) (*os.File, fs.FileInfo, error) {
+	f, info, err := gds.GFS.Open(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := gds.recordDownload(u, path); err != nil {
+		log.Println(err)
+	}
+
+	return f, info, nil
+}
+
+func (gds *Service) Hash(path string) (string, error) {
+	return gds.GFS.BlobHash(path)
+}
+
+// Write overwrites an existing file if its blob hash still equals hash.
+// It returns the commit operation and the new blob hash.
+func (gds *Service) Write(u User, path, hash string, content io.Reader) (*Operation, string, error) {
+	if hash == "" {
+		return nil, "", ErrPreconditionRequired
+	}
+
+	b, err := io.ReadAll(content)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, hash, err := gds.GFS.Write(path, b, hash, u.author(), gds.quota(u))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return gds.track(id, 'w'), hash, nil
+}
+
+// Restore brings the file or folder at path back to its content at ref, as long as it fits in the quotas.
+func (gds *Service) Restore(u User, path, ref string) (*Operation, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("restore of \"%v\" has no ref: %w", path, ErrInvalidRequest)
+	}
+
+	id, err := gds.GFS.Restore(ref, path, u.author(), gds.quota(u))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gds.track(id, 's'), nil
+}
+
+func (gds *Service) Lock(u User, path string) (*git.Lock, error) {
+	if u.Anonymous() {
+		return nil, ErrUnauthenticated
+	}
+
+	return gds.GFS.Lock(path, u.Email, u.Name)
+}
+
+func (gds *Service) Unlock(u User, path string) error {
+	if u.Anonymous() {
+		return ErrUnauthenticated
+	}
+
+	return gds.GFS.Unlock(path, u.Email, u.Name)
+}
+
+func (gds *Service) Locks() ([]git.Lock, error) {
+	return gds.GFS.Locks()
+}
+
 func (gds *Service) ListeOperation(id int64) (chan *Operation, error) {
-	op := gds.ops[id]
+	var kind byte
+	var found bool
+
+	gds.ops.read(func(ops map[int64]byte) { kind, found = ops[id] })
 
-	if op == nil {
+	if !found {
 		return nil, fmt.Errorf("Operation with id %d not found", id)
 	}
 
+	tracked := &Operation{Id: id, Op: kind}
+
 	out := make(chan *Operation)
 
 	go func() {
 		defer close(out)
 		for p := range gds.GFS.Processor.ListenOperation(id) {
+			op := *tracked
 			op.Progress = p.Progress
 			op.Status = p.Status
+			op.Hash = p.Hash
+			op.Conflicts = p.Conflicts
 
-			out <- op
+			out <- &op
 		}
 	}()
 
 	return out, nil
 }
+
+// CancelOperation undoes an operation of u that was not pushed yet: before it is committed its change is dropped,
+// afterwards it is reverted by a new commit.
+func (gds *Service) CancelOperation(u User, id int64) error {
+	return gds.GFS.Processor.Cancel(id, u.author())
+}
+
+// Sync fetches and merges the remote right away.
+func (gds *Service) Sync() error {
+	return gds.GFS.Processor.Sync()
+}
+
+// Status reports whether the drive reaches its remote and how many operations await push.
+func (gds *Service) Status() git.RemoteStatus {
+	return gds.GFS.Processor.RemoteStatus()
+}
+
+// Close stops the drive: mutations fail from now on and the pending ones are committed and pushed within ctx.
+func (gds *Service) Close(ctx context.Context) error {
+	return gds.GFS.Processor.Close(ctx)
+}
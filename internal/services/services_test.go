@@ -0,0 +1,78 @@
+package services_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/prxg22/git-drive/internal/services"
+	"github.com/prxg22/git-drive/internal/testutil"
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+var alice = services.User{Name: "Alice", Email: "alice@example.com"}
+var bob = services.User{Name: "Bob", Email: "bob@example.com"}
+
+// newService creates a drive service over a clone of a bare repository seeded with files.
+// It returns the service and its state directory.
+func newService(t *testing.T, files map[string]string, quotas *services.Quotas) (*services.Service, string) {
+	t.Helper()
+
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, files)
+
+	gc, err := git.NewGitClient(url, "origin", "", testutil.LocalPath(t), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gc.PullEvery(time.Hour)
+
+	if quotas == nil {
+		quotas = &services.Quotas{}
+	}
+
+	state := t.TempDir()
+	gds, err := services.NewGitDriveService(git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT), quotas, state)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return gds, state
+}
+
+func TestRestore(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/c.txt": "c"}, nil)
+
+	seed, err := gds.GFS.Processor.ResolveRevision("HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := gds.Batch(alice, []services.BatchStep{{Op: "remove", Path: "dir"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := gds.Restore(alice, "dir", ""); !errors.Is(err, services.ErrInvalidRequest) {
+		t.Errorf("Expected ErrInvalidRequest, got %v", err)
+	}
+	if _, err := gds.Restore(alice, "missing", seed); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+
+	if _, err := gds.Restore(alice, "dir", seed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for p, content := range map[string]string{"dir/b.txt": "b", "dir/c.txt": "c"} {
+		if b, _ := os.ReadFile(path.Join(gds.GFS.Path, p)); string(b) != content {
+			t.Errorf("Expected %v to be restored, got %q", p, b)
+		}
+	}
+
+	if _, err := gds.Restore(alice, "dir", seed); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist for a folder already restored, got %v", err)
+	}
+}
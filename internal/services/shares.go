@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrShareNotFound = errors.New("share not found")
+var ErrShareExpired = errors.New("share expired")
+var ErrSharePassword = errors.New("share password mismatch")
+
+// SHARE_PREFIX is the default public route prefix under which share links are served.
+const SHARE_PREFIX = "/_api/shared/"
+
+type ShareRequest struct {
+	Path         string    `json:"path"`
+	Commit       string    `json:"commit"`       // Commit pins the share to a revision. Optional.
+	Expires      time.Time `json:"expires"`      // Expires is mandatory and must be in the future.
+	Password     string    `json:"password"`     // Password protects the link. Optional.
+	MaxDownloads int       `json:"maxDownloads"` // MaxDownloads limits file downloads; zero means unlimited.
+}
+
+type Share struct {
+	Id           string    `json:"id"`
+	Owner        string    `json:"owner"`
+	Path         string    `json:"path"`
+	Commit       string    `json:"commit,omitempty"`
+	Expires      time.Time `json:"expires"`
+	MaxDownloads int       `json:"maxDownloads"`
+	Downloads    int       `json:"downloads"`
+	Protected    bool      `json:"protected"`
+	Link         string    `json:"link,omitempty"`
+	Salt         string    `json:"salt,omitempty"`
+	Password     string    `json:"password,omitempty"` // HMAC of the salted password.
+}
+
+// SharedContent is what a share link resolves to: either a folder listing or a file.
+type SharedContent struct {
+	Files   []FileInfo
+	Name    string
+	ModTime time.Time
+	Content io.ReadSeeker // Content is closed by the caller if it implements io.Closer.
+}
+
+// public strips the secrets of a share before it is returned to a client.
+func (s Share) public(prefix string, secret []byte) Share {
+	s.Salt, s.Password = "", ""
+	s.Link = prefix + s.Id + "." + s.signature(secret)
+	return s
+}
+
+func (s *Share) signature(secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", s.Id, s.Path, s.Commit, s.Expires.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashPassword(secret []byte, salt, password string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(salt + password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// loadSecret reads the HMAC key for share links from the state directory, creating it on first use.
+func loadSecret(state string) ([]byte, error) {
+	p := path.Join(state, "share.key")
+	b, err := os.ReadFile(p)
+
+	if err == nil {
+		return b, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read share key \"%v\": %w", p, err)
+	}
+
+	b = make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(p, b, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write share key \"%v\": %w", p, err)
+	}
+
+	return b, nil
+}
+
+func (gds *Service) CreateShare(u User, req ShareRequest) (*Share, error) {
+	if u.Anonymous() {
+		return nil, ErrUnauthenticated
+	}
+
+	if !req.Expires.After(time.Now()) {
+		return nil, fmt.Errorf("share expiry must be in the future: %w", ErrInvalidRequest)
+	}
+
+	share := Share{
+		Owner:        u.Email,
+		Path:         cleanPath(req.Path),
+		Expires:      req.Expires,
+		MaxDownloads: req.MaxDownloads,
+	}
+
+	var err error
+
+	if req.Commit != "" {
+		if share.Commit, err = gds.GFS.Processor.ResolveRevision(req.Commit); err != nil {
+			return nil, err
+		}
+		_, err = gds.GFS.Processor.StatAt(share.Commit, share.Path)
+	} else {
+		_, err = gds.GFS.Stat(share.Path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if share.Id, err = randomString(12); err != nil {
+		return nil, err
+	}
+
+	if req.Password != "" {
+		if share.Salt, err = randomString(12); err != nil {
+			return nil, err
+		}
+		share.Password = hashPassword(gds.secret, share.Salt, req.Password)
+		share.Protected = true
+	}
+
+	err = gds.shares.update(func(shares *map[string]Share) error {
+		(*shares)[share.Id] = share
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := share.public(gds.SharePrefix, gds.secret)
+	return &s, nil
+}
+
+// Shares lists the shares created by the user.
+func (gds *Service) Shares(u User) ([]Share, error) {
+	if u.Anonymous() {
+		return nil, ErrUnauthenticated
+	}
+
+	list := []Share{}
+	gds.shares.read(func(shares map[string]Share) {
+		for _, s := range shares {
+			if s.Owner == u.Email {
+				list = append(list, s.public(gds.SharePrefix, gds.secret))
+			}
+		}
+	})
+
+	slices.SortFunc(list, func(a, b Share) int { return a.Expires.Compare(b.Expires) })
+
+	return list, nil
+}
+
+// RevokeShare deletes one of the user's shares, invalidating its link.
+func (gds *Service) RevokeShare(u User, id string) error {
+	if u.Anonymous() {
+		return ErrUnauthenticated
+	}
+
+	return gds.shares.update(func(shares *map[string]Share) error {
+		if s, ok := (*shares)[id]; !ok || s.Owner != u.Email {
+			return ErrShareNotFound
+		}
+		delete(*shares, id)
+		return nil
+	})
+}
+
+// OpenShare verifies a share token and resolves sub, a path relative to the shared path.
+// Folders resolve to a listing and files to their content. Paths hidden from the listings, such as ignored files,
+// do not resolve. Opening a file counts one download if count reports true for its size,
+// and fails once the share's download limit is reached; requests resuming a counted download report false.
+func (gds *Service) OpenShare(token, sub, password string, count func(size int64) bool) (*SharedContent, error) {
+	id, sig, _ := strings.Cut(token, ".")
+
+	var share Share
+	var ok bool
+	gds.shares.read(func(shares map[string]Share) {
+		share, ok = shares[id]
+	})
+
+	if !ok || !hmac.Equal([]byte(sig), []byte(share.signature(gds.secret))) {
+		return nil, ErrShareNotFound
+	}
+
+	if time.Now().After(share.Expires) {
+		return nil, ErrShareExpired
+	}
+
+	if share.Protected && !hmac.Equal([]byte(share.Password), []byte(hashPassword(gds.secret, share.Salt, password))) {
+		return nil, ErrSharePassword
+	}
+
+	p := cleanPath(path.Join(share.Path, path.Join("/", sub)))
+	gfs := gds.GFS
+
+	var info fs.FileInfo
+	var err error
+
+	if share.Commit != "" {
+		info, err = gfs.Processor.StatAt(share.Commit, p)
+	} else {
+		info, err = gfs.Stat(p)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if visible, err := gfs.VisibleFrom(share.Path, p, info.IsDir()); err != nil {
+		return nil, err
+	} else if !visible {
+		return nil, fmt.Errorf("failed to open shared \"%v\": %w", sub, fs.ErrNotExist)
+	}
+
+	if info.IsDir() {
+		var infos []fs.FileInfo
+
+		if share.Commit != "" {
+			infos, err = gfs.ReadDirAt(share.Commit, p, false)
+		} else {
+			infos, err = gfs.ReadDir(p, false)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		files := make([]FileInfo, len(infos))
+		for i, f := range infos {
+			files[i] = FileInfo{Name: f.Name(), IsDir: f.IsDir(), Size: float64(f.Size()) / 1280}
+		}
+
+		return &SharedContent{Files: files, Name: info.Name(), ModTime: info.ModTime()}, nil
+	}
+
+	if share.Commit != "" {
+		b, info, err := gfs.OpenAt(share.Commit, p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := gds.countDownload(id, count(int64(len(b)))); err != nil {
+			return nil, err
+		}
+
+		return &SharedContent{Name: info.Name(), ModTime: info.ModTime(), Content: bytes.NewReader(b)}, nil
+	}
+
+	f, info, err := gfs.Open(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gds.countDownload(id, count(info.Size())); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &SharedContent{Name: info.Name(), ModTime: info.ModTime(), Content: f}, nil
+}
+
+// countDownload counts a download of share id if count is set, failing once its download limit is reached.
+func (gds *Service) countDownload(id string, count bool) error {
+	if !count {
+		return nil
+	}
+
+	return gds.shares.update(func(shares *map[string]Share) error {
+		s, ok := (*shares)[id]
+
+		if !ok {
+			return ErrShareNotFound
+		}
+
+		if s.MaxDownloads > 0 && s.Downloads >= s.MaxDownloads {
+			return fmt.Errorf("download limit of %d reached: %w", s.MaxDownloads, ErrShareExpired)
+		}
+
+		s.Downloads++
+		(*shares)[id] = s
+		return nil
+	})
+}
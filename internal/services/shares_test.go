@@ -0,0 +1,104 @@
+package services_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+func always(int64) bool { return true }
+
+func never(int64) bool { return false }
+
+func TestOpenShareDownloads(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"dir/a.txt": "a"}, nil)
+
+	share, err := gds.CreateShare(alice, services.ShareRequest{Path: "dir", Expires: time.Now().Add(time.Hour), Password: "secret", MaxDownloads: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	token := strings.TrimPrefix(share.Link, gds.SharePrefix)
+
+	if _, err := gds.OpenShare(token, "a.txt", "wrong", always); !errors.Is(err, services.ErrSharePassword) {
+		t.Errorf("Expected ErrSharePassword, got %v", err)
+	}
+	if _, err := gds.OpenShare(token, "missing.txt", "secret", always); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+
+	content, err := gds.OpenShare(token, "a.txt", "secret", always)
+	if err != nil {
+		t.Fatalf("Expected a failed open not to count as a download, got %v", err)
+	}
+	if b, _ := io.ReadAll(content.Content); string(b) != "a" {
+		t.Errorf("Expected \"a\", got %q", b)
+	}
+	content.Content.(io.Closer).Close()
+
+	if content, err := gds.OpenShare(token, "a.txt", "secret", never); err != nil {
+		t.Errorf("Expected a resumed download to be served, got %v", err)
+	} else {
+		content.Content.(io.Closer).Close()
+	}
+
+	if _, err := gds.OpenShare(token, "a.txt", "secret", always); !errors.Is(err, services.ErrShareExpired) {
+		t.Errorf("Expected the download limit to be reached, got %v", err)
+	}
+
+	shares, err := gds.Shares(alice)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(shares) != 1 || shares[0].Downloads != 1 {
+		t.Errorf("Expected one download, got %+v", shares)
+	}
+}
+
+func TestOpenShareHidden(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"dir/a.txt": "a", ".gitignore": "*.env\nlogs/\n"}, nil)
+
+	for p, content := range map[string]string{"dir/.env": "SECRET=1", "dir/logs/today.txt": "log"} {
+		fp := path.Join(gds.GFS.Path, p)
+		if err := os.MkdirAll(path.Dir(fp), 0o755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	share, err := gds.CreateShare(alice, services.ShareRequest{Path: "dir", Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	token := strings.TrimPrefix(share.Link, gds.SharePrefix)
+
+	for _, sub := range []string{".env", "logs", "logs/today.txt", "../.gitignore/../dir/.env"} {
+		if _, err := gds.OpenShare(token, sub, "", always); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected fs.ErrNotExist for %v, got %v", sub, err)
+		}
+	}
+
+	content, err := gds.OpenShare(token, "", "", always)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(content.Files) != 1 || content.Files[0].Name != "a.txt" {
+		t.Errorf("Expected only a.txt to be listed, got %+v", content.Files)
+	}
+
+	if content, err := gds.OpenShare(token, "a.txt", "", always); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else {
+		content.Content.(io.Closer).Close()
+	}
+}
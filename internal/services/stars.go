@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrUnauthenticated = errors.New("request has no user identity")
+
+// RECENT_MAX_SIZE is the maximum number of entries returned by Recent and kept per user in the downloads log.
+const RECENT_MAX_SIZE = 50
+
+type StarredFile struct {
+	Path string `json:"path"`
+	FileInfo
+}
+
+type RecentFile struct {
+	Path   string    `json:"path"`
+	Action string    `json:"action"` // "commit" or "download"
+	When   time.Time `json:"when"`
+}
+
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Join("/", strings.TrimSpace(p)), "/")
+}
+
+func (gds *Service) Star(u User, p string) error {
+	if u.Anonymous() {
+		return ErrUnauthenticated
+	}
+
+	p = cleanPath(p)
+
+	if _, err := gds.GFS.Stat(p); err != nil {
+		return err
+	}
+
+	return gds.starred.update(func(stars *map[string][]string) error {
+		if !slices.Contains((*stars)[u.Email], p) {
+			(*stars)[u.Email] = append((*stars)[u.Email], p)
+		}
+		return nil
+	})
+}
+
+func (gds *Service) Unstar(u User, p string) error {
+	if u.Anonymous() {
+		return ErrUnauthenticated
+	}
+
+	p = cleanPath(p)
+
+	return gds.starred.update(func(stars *map[string][]string) error {
+		(*stars)[u.Email] = slices.DeleteFunc((*stars)[u.Email], func(s string) bool { return s == p })
+		return nil
+	})
+}
+
+// Stars lists the user's starred paths that still exist in the drive.
+func (gds *Service) Stars(u User) ([]StarredFile, error) {
+	if u.Anonymous() {
+		return nil, ErrUnauthenticated
+	}
+
+	var paths []string
+	gds.starred.read(func(stars map[string][]string) {
+		paths = slices.Clone(stars[u.Email])
+	})
+
+	files := []StarredFile{}
+
+	for _, p := range paths {
+		if info, err := gds.GFS.Stat(p); err == nil {
+			files = append(files, StarredFile{p, FileInfo{Name: info.Name(), IsDir: info.IsDir(), Size: float64(info.Size()) / 1280}})
+		}
+	}
+
+	return files, nil
+}
+
+// renameStars moves every star on from, or under it, to the same place under to.
+// A star already on the new path is kept once. Moves must call it so stars survive renames.
+func (gds *Service) renameStars(from, to string) error {
+	from, to = cleanPath(from), cleanPath(to)
+
+	return gds.starred.update(func(stars *map[string][]string) error {
+		for u, paths := range *stars {
+			for i, p := range paths {
+				if p == from {
+					paths[i] = to
+				} else if strings.HasPrefix(p, from+"/") {
+					paths[i] = to + strings.TrimPrefix(p, from)
+				}
+			}
+
+			seen := map[string]bool{}
+			(*stars)[u] = slices.DeleteFunc(paths, func(p string) bool {
+				dup := seen[p]
+				seen[p] = true
+				return dup
+			})
+		}
+		return nil
+	})
+}
+
+// dropStars removes every star on p, or under it.
+func (gds *Service) dropStars(p string) error {
+	p = cleanPath(p)
+
+	return gds.starred.update(func(stars *map[string][]string) error {
+		for u, paths := range *stars {
+			(*stars)[u] = slices.DeleteFunc(paths, func(s string) bool {
+				return s == p || strings.HasPrefix(s, p+"/")
+			})
+		}
+		return nil
+	})
+}
+
+func (gds *Service) recordDownload(u User, p string) error {
+	if u.Anonymous() {
+		return nil
+	}
+
+	return gds.downloads.update(func(downloads *map[string][]RecentFile) error {
+		d := append([]RecentFile{{cleanPath(p), "download", time.Now()}}, (*downloads)[u.Email]...)
+		if len(d) > RECENT_MAX_SIZE {
+			d = d[:RECENT_MAX_SIZE]
+		}
+		(*downloads)[u.Email] = d
+		return nil
+	})
+}
+
+// Recent lists the files the user recently committed or downloaded, newest first, once per path.
+func (gds *Service) Recent(u User) ([]RecentFile, error) {
+	if u.Anonymous() {
+		return nil, ErrUnauthenticated
+	}
+
+	changes, err := gds.GFS.Processor.ChangesBy(u.Email, RECENT_MAX_SIZE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var recent []RecentFile
+	gds.downloads.read(func(downloads map[string][]RecentFile) {
+		recent = slices.Clone(downloads[u.Email])
+	})
+
+	for _, c := range changes {
+		recent = append(recent, RecentFile{c.Path, "commit", c.When})
+	}
+
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].When.After(recent[j].When) })
+
+	files := []RecentFile{}
+	seen := map[string]bool{}
+
+	for _, r := range recent {
+		if seen[r.Path] || len(files) == RECENT_MAX_SIZE {
+			continue
+		}
+
+		if _, err := gds.GFS.Stat(r.Path); err == nil {
+			seen[r.Path] = true
+			files = append(files, r)
+		}
+	}
+
+	return files, nil
+}
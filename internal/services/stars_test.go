@@ -0,0 +1,69 @@
+package services_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/prxg22/git-drive/internal/services"
+)
+
+func TestBatchMoveStars(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "a", "b.txt": "b", "dir/c.txt": "c"}, nil)
+
+	for _, p := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		if err := gds.Star(alice, p); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// removed outside the drive, so its star is left behind
+	if err := os.Remove(path.Join(gds.GFS.Path, "b.txt")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	steps := []services.BatchStep{{Op: "move", Path: "a.txt", To: "b.txt"}, {Op: "move", Path: "dir", To: "moved"}}
+
+	if _, err := gds.Batch(alice, steps); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stars, err := gds.Stars(alice)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	paths := []string{}
+	for _, s := range stars {
+		paths = append(paths, s.Path)
+	}
+
+	if len(paths) != 2 || paths[0] != "b.txt" || paths[1] != "moved/c.txt" {
+		t.Errorf("Expected the stars to follow the moves once, got %v", paths)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	gds, _ := newService(t, map[string]string{"a.txt": "a", "b.txt": "b"}, nil)
+
+	hash, err := gds.Hash("a.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := gds.Write(alice, "a.txt", hash, strings.NewReader("alice")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	recent, err := gds.Recent(alice)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(recent) != 1 || recent[0].Path != "a.txt" || recent[0].Action != "commit" {
+		t.Errorf("Expected alice's commit of a.txt, got %+v", recent)
+	}
+
+	if recent, _ := gds.Recent(bob); len(recent) != 0 {
+		t.Errorf("Expected nothing for bob, got %+v", recent)
+	}
+}
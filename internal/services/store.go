@@ -0,0 +1,69 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+// store persists a value as a JSON file in the server's state directory.
+type store[T any] struct {
+	mu   sync.Mutex
+	path string
+	data T
+}
+
+func openStore[T any](dir, name string, data T) (*store[T], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory \"%v\": %w", dir, err)
+	}
+
+	s := &store[T]{path: path.Join(dir, name), data: data}
+	b, err := os.ReadFile(s.path)
+
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read \"%v\": %w", s.path, err)
+	}
+
+	if err := json.Unmarshal(b, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse \"%v\": %w", s.path, err)
+	}
+
+	return s, nil
+}
+
+// read calls fn with the stored value under the store's lock.
+func (s *store[T]) read(fn func(data T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(s.data)
+}
+
+// update calls fn with the stored value under the store's lock and writes the result to disk.
+func (s *store[T]) update(fn func(data *T) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := fn(&s.data); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(s.data)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write \"%v\": %w", s.path, err)
+	}
+
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,25 @@
+package services
+
+import "github.com/prxg22/git-drive/pkg/git"
+
+// User identifies the person behind a request.
+// Authentication is delegated to the proxy in front of the server, which forwards the identity.
+type User struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Anonymous reports whether the request carried no identity.
+func (u User) Anonymous() bool {
+	return u.Email == ""
+}
+
+// author returns the commit author for the user's changes, or nil for anonymous requests,
+// which are then attributed to the server.
+func (u User) author() *git.Author {
+	if u.Anonymous() {
+		return nil
+	}
+
+	return &git.Author{Name: u.Name, Email: u.Email}
+}
@@ -0,0 +1,87 @@
+// Package testutil holds the git fixtures shared by the drive's test suites.
+package testutil
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// NewRemote creates a bare repository seeded with files and returns its file:// URL.
+func NewRemote(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	bare := path.Join(dir, "remote.git")
+	seed := path.Join(dir, "seed")
+
+	if _, err := gogit.PlainInit(bare, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	repo, err := gogit.PlainInit(seed, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w, _ := repo.Worktree()
+
+	for p, content := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(seed, p)), 0o755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.WriteFile(path.Join(seed, p), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := w.Add(p); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	author := &object.Signature{Name: "seed", Email: "seed@example.com", When: time.Now()}
+	if _, err := w.Commit("seed", &gogit.CommitOptions{Author: author}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	url := "file://" + bare
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.Push(&gogit.PushOptions{RemoteName: "origin"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return url
+}
+
+// WithIdentity points the global git config at a test identity, so commits have an author.
+func WithIdentity(t testing.TB) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	config := "[user]\n\tname = drive\n\temail = drive@example.com\n"
+	if err := os.WriteFile(path.Join(home, ".gitconfig"), []byte(config), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// LocalPath returns a path for a client's clone. The client's processing loop keeps running after the test,
+// so the clone is removed on a best-effort basis instead of through t.TempDir.
+func LocalPath(t testing.TB) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "git-drive-test-")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return path.Join(dir, "drive")
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	AUTH_SSH   = "ssh"   // SSH private key.
+	AUTH_BASIC = "basic" // HTTP basic auth with a username and password.
+	AUTH_TOKEN = "token" // HTTP basic auth with an access token as password, like GitHub, Gitea and GitLab deploy tokens.
+	AUTH_NONE  = "none"  // No authentication, for public or local remotes.
+)
+
+// TOKEN_USER is the username sent with token auth when none is configured. Git hosts accept any non-empty one.
+const TOKEN_USER = "git-drive"
+
+var ErrMissingCredential = errors.New("missing credential")
+
+// AuthConfig describes how to authenticate against the remote.
+type AuthConfig struct {
+	Method string // Method is one of AUTH_SSH, AUTH_BASIC, AUTH_TOKEN or AUTH_NONE.
+	User   string // User is the username of basic and token auth.
+	Key    string // Key is the path of the SSH private key.
+	Secret string // Secret is the password of the SSH key, or the password or token of basic and token auth.
+	HostKeyConfig
+}
+
+// AuthMethod builds the go-git authentication method for the configuration.
+// AUTH_NONE returns a nil method.
+func (c AuthConfig) AuthMethod() (transport.AuthMethod, error) {
+	switch c.Method {
+	case AUTH_SSH, "":
+		if c.Key == "" {
+			return nil, fmt.Errorf("ssh auth needs a private key: %w", ErrMissingCredential)
+		}
+
+		auth, err := ssh.NewPublicKeysFromFile("git", c.Key, c.Secret)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed getting keys on path \"%v\": %w", c.Key, err)
+		}
+
+		if auth.HostKeyCallback, err = c.HostKeyCallback(); err != nil {
+			return nil, err
+		}
+
+		return sshAuth{auth}, nil
+	case AUTH_BASIC:
+		if c.User == "" || c.Secret == "" {
+			return nil, fmt.Errorf("basic auth needs a user and a password: %w", ErrMissingCredential)
+		}
+
+		return &http.BasicAuth{Username: c.User, Password: c.Secret}, nil
+	case AUTH_TOKEN:
+		if c.Secret == "" {
+			return nil, fmt.Errorf("token auth needs a token: %w", ErrMissingCredential)
+		}
+
+		user := c.User
+
+		if user == "" {
+			user = TOKEN_USER
+		}
+
+		return &http.BasicAuth{Username: user, Password: c.Secret}, nil
+	case AUTH_NONE:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown auth method \"%v\"", c.Method)
+	}
+}
+
+// sshAuth bounds the connection to an SSH remote by PUSH_TIMEOUT, as the context of a fetch or push
+// only covers the exchange once connected.
+type sshAuth struct {
+	*ssh.PublicKeys
+}
+
+func (a sshAuth) ClientConfig() (*gossh.ClientConfig, error) {
+	config, err := a.PublicKeys.ClientConfig()
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.Timeout = PUSH_TIMEOUT * time.Second
+
+	return config, nil
+}
+
+// ReadSecret reads a credential from a file or, if file is empty, from the environment variable env.
+// Surrounding whitespace, such as a trailing newline, is trimmed.
+func ReadSecret(file, env string) (string, error) {
+	if file != "" {
+		b, err := os.ReadFile(file)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret \"%v\": %w", file, err)
+		}
+
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if env != "" {
+		return strings.TrimSpace(os.Getenv(env)), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,64 @@
+package git_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+func TestAuthConfigToken(t *testing.T) {
+	auth, err := git.AuthConfig{Method: git.AUTH_TOKEN, Secret: "t0k3n"}.AuthMethod()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	basic, ok := auth.(*http.BasicAuth)
+	if !ok {
+		t.Fatalf("Expected basic auth, got %T", auth)
+	}
+	if basic.Username != git.TOKEN_USER || basic.Password != "t0k3n" {
+		t.Errorf("Expected %v:t0k3n, got %v:%v", git.TOKEN_USER, basic.Username, basic.Password)
+	}
+
+	if url := git.GitHubURL("prxg22", "drive", auth); url != "https://github.com/prxg22/drive" {
+		t.Errorf("Expected https url for token auth, got %v", url)
+	}
+}
+
+func TestAuthConfigMissingCredential(t *testing.T) {
+	for _, c := range []git.AuthConfig{
+		{Method: git.AUTH_SSH},
+		{Method: git.AUTH_BASIC, User: "drive"},
+		{Method: git.AUTH_TOKEN},
+	} {
+		if _, err := c.AuthMethod(); !errors.Is(err, git.ErrMissingCredential) {
+			t.Errorf("Expected missing credential for %v, got %v", c.Method, err)
+		}
+	}
+}
+
+func TestAuthConfigNone(t *testing.T) {
+	auth, err := git.AuthConfig{Method: git.AUTH_NONE}.AuthMethod()
+	if err != nil || auth != nil {
+		t.Errorf("Expected no auth, got %v, %v", auth, err)
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	file := path.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv("GIT_DRIVE_TEST_SECRET", "from-env")
+
+	if s, _ := git.ReadSecret(file, "GIT_DRIVE_TEST_SECRET"); s != "from-file" {
+		t.Errorf("Expected from-file, got %q", s)
+	}
+	if s, _ := git.ReadSecret("", "GIT_DRIVE_TEST_SECRET"); s != "from-env" {
+		t.Errorf("Expected from-env, got %q", s)
+	}
+}
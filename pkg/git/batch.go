@@ -0,0 +1,443 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var ErrUnknownStep = errors.New("unknown batch step")
+
+// Step is one mutation of a batch.
+type Step struct {
+	Op     string `json:"op"`           // Op is one of "remove", "move", "copy", "mkdir" or "write".
+	Path   string `json:"path"`         // Path is the target of the step, or the source of move and copy.
+	To     string `json:"to,omitempty"` // To is the destination of move and copy.
+	Source string `json:"-"`            // Source is the local file holding the content of a write.
+}
+
+// batch applies steps to the worktree while recording how to undo them.
+type batch struct {
+	gfs   *GitFileSystem
+	trash string
+	undo  []func() error
+	paths []string
+	force bool
+}
+
+// Batch applies the steps in order and commits all of them as a single commit, before returning.
+// If any step or the commit fails, the steps already applied are undone in reverse order and nothing is committed.
+// Steps on paths locked by someone other than author fail the batch with ErrLocked before anything is applied.
+// Copies and writes are checked against quota, as well, before anything is applied.
+// It returns the commit operation ID. The commit is attributed to author, or to the server if nil.
+func (gfs *GitFileSystem) Batch(steps []Step, author *Author, quota QuotaCheck) (int64, error) {
+	return gfs.Processor.change(func() (int64, error) { return gfs.batch(steps, author, quota) })
+}
+
+func (gfs *GitFileSystem) batch(steps []Step, author *Author, quota QuotaCheck) (int64, error) {
+	gc := gfs.Processor
+	b := newBatch(gfs)
+	defer os.RemoveAll(b.trash)
+
+	steps = slices.Clone(steps)
+	summary := make([]string, len(steps))
+	targets := []string{}
+
+	for i := range steps {
+		steps[i].Path = strings.Trim(path.Join("/", steps[i].Path), "/")
+
+		if steps[i].To != "" {
+			steps[i].To = strings.Trim(path.Join("/", steps[i].To), "/")
+			targets = append(targets, steps[i].To)
+		}
+
+		targets = append(targets, steps[i].Path)
+
+		for _, p := range []string{steps[i].Path, steps[i].To} {
+			if p == "" {
+				continue
+			}
+
+			if err := gfs.checkLock(p, author.email()); err != nil {
+				return -1, err
+			}
+		}
+
+		summary[i] = steps[i].Op + " " + steps[i].Path
+
+		if steps[i].To != "" {
+			summary[i] += " -> " + steps[i].To
+		}
+	}
+
+	var delta Usage
+
+	for _, s := range steps {
+		growth, err := b.growth(s)
+
+		if err != nil {
+			return -1, fmt.Errorf("batch step %v \"%v\": %w", s.Op, s.Path, err)
+		}
+
+		delta = delta.Add(growth)
+	}
+
+	if err := gc.checkQuota(quota, delta); err != nil {
+		return -1, err
+	}
+
+	// the steps' targets own the paths until the batch knows every file it changed
+	cmd := gc.begin("batch: "+strings.Join(summary, " | "), targets, &CommitOptions{Author: author})
+
+	for i, s := range steps {
+		if err := b.apply(s); err != nil {
+			b.rollback()
+			err = fmt.Errorf("batch step %d (%v \"%v\") failed: %w", i, s.Op, s.Path, err)
+			gc.abort(cmd, err)
+			return -1, err
+		}
+	}
+
+	if err := b.commit(cmd); err != nil {
+		return -1, fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	return cmd.id, nil
+}
+
+func newBatch(gfs *GitFileSystem) *batch {
+	return &batch{gfs: gfs, trash: path.Join(gfs.Path, ".git", "git-drive-trash", strconv.FormatInt(time.Now().UnixNano(), 10))}
+}
+
+// commit commits the paths the batch changed as cmd before returning, rolling the batch back if it fails.
+func (b *batch) commit(cmd *command) error {
+	gc := b.gfs.Processor
+
+	slices.Sort(b.paths)
+	cmd.paths = slices.Compact(b.paths)
+	cmd.force = b.force
+
+	if err := gc.commitNow(cmd); err != nil {
+		b.rollback()
+
+		// the index may hold some of the paths already: stage them back as the rollback left them
+		if err := gc.add(cmd.paths, true); err != nil {
+			log.Println(fmt.Errorf("failed to unstage batch: %w", err))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// growth returns how much a step adds to the usage, as the worktree is before the batch:
+// copies add their source, and writes their content minus the file they replace.
+func (b *batch) growth(s Step) (Usage, error) {
+	switch s.Op {
+	case "copy":
+		return b.gfs.usage(s.Path)
+	case "write":
+		info, err := os.Stat(s.Source)
+
+		if err != nil {
+			return Usage{}, err
+		}
+
+		delta := Usage{Size: info.Size(), Files: 1}
+
+		if old, err := os.Stat(b.abs(s.Path)); err == nil && !old.IsDir() {
+			delta = delta.Add(Usage{Size: -old.Size(), Files: -1})
+		}
+
+		return delta, nil
+	}
+
+	return Usage{}, nil
+}
+
+func (b *batch) abs(p string) string {
+	return path.Join(b.gfs.Path, p)
+}
+
+func (b *batch) check(paths ...string) error {
+	for _, p := range paths {
+		force, err := b.gfs.checkIgnored(p)
+
+		if err != nil {
+			return err
+		}
+
+		b.force = b.force || force
+	}
+
+	return nil
+}
+
+// absent fails if p already exists, so a step never silently overwrites content.
+func (b *batch) absent(p string) error {
+	if _, err := os.Lstat(b.abs(p)); err == nil {
+		return fmt.Errorf("\"%v\": %w", p, fs.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (b *batch) apply(s Step) error {
+	switch s.Op {
+	case "remove":
+		if err := b.check(s.Path); err != nil {
+			return err
+		}
+		return b.remove(s.Path)
+	case "move":
+		if err := b.check(s.Path, s.To); err != nil {
+			return err
+		}
+		return b.move(s.Path, s.To)
+	case "copy":
+		if err := b.check(s.Path, s.To); err != nil {
+			return err
+		}
+		return b.copy(s.Path, s.To)
+	case "mkdir":
+		if err := b.check(s.Path); err != nil {
+			return err
+		}
+		return b.mkdir(s.Path)
+	case "write":
+		if err := b.check(s.Path); err != nil {
+			return err
+		}
+		return b.write(s.Source, s.Path)
+	default:
+		return fmt.Errorf("%w \"%v\"", ErrUnknownStep, s.Op)
+	}
+}
+
+// stash moves p to the batch's trash, from where rollback restores it.
+func (b *batch) stash(p string) error {
+	dst := path.Join(b.trash, strconv.Itoa(len(b.undo)))
+
+	if err := os.MkdirAll(b.trash, 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(b.abs(p), dst); err != nil {
+		return err
+	}
+
+	b.undo = append(b.undo, func() error { return os.Rename(dst, b.abs(p)) })
+
+	return nil
+}
+
+func (b *batch) remove(p string) error {
+	files, err := b.gfs.files(p)
+
+	if err != nil {
+		return err
+	}
+
+	if err := b.stash(p); err != nil {
+		return err
+	}
+
+	b.paths = append(b.paths, files...)
+
+	return nil
+}
+
+func (b *batch) move(from, to string) error {
+	files, err := b.gfs.files(from)
+
+	if err != nil {
+		return err
+	}
+
+	if err := b.absent(to); err != nil {
+		return err
+	}
+
+	if err := b.mkdir(path.Dir(to)); err != nil {
+		return err
+	}
+
+	if err := os.Rename(b.abs(from), b.abs(to)); err != nil {
+		return err
+	}
+
+	b.undo = append(b.undo, func() error { return os.Rename(b.abs(to), b.abs(from)) })
+
+	for _, f := range files {
+		b.paths = append(b.paths, f, path.Join(to, strings.TrimPrefix(f, from)))
+	}
+
+	return nil
+}
+
+func (b *batch) copy(from, to string) error {
+	files, err := b.gfs.files(from)
+
+	if err != nil {
+		return err
+	}
+
+	if err := b.absent(to); err != nil {
+		return err
+	}
+
+	if err := b.mkdir(path.Dir(to)); err != nil {
+		return err
+	}
+
+	b.undo = append(b.undo, func() error { return os.RemoveAll(b.abs(to)) })
+
+	for _, f := range files {
+		dst := path.Join(to, strings.TrimPrefix(f, from))
+
+		if err := copyFile(b.abs(f), b.abs(dst)); err != nil {
+			return err
+		}
+
+		b.paths = append(b.paths, dst)
+	}
+
+	return nil
+}
+
+// mkdir creates p and its missing parents, undoing only the directories it created.
+func (b *batch) mkdir(p string) error {
+	created := ""
+
+	for d := p; d != "." && d != "" && d != "/"; d = path.Dir(d) {
+		if _, err := os.Stat(b.abs(d)); os.IsNotExist(err) {
+			created = d
+		} else {
+			break
+		}
+	}
+
+	if created == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(b.abs(p), 0o755); err != nil {
+		return err
+	}
+
+	b.undo = append(b.undo, func() error { return os.RemoveAll(b.abs(created)) })
+
+	return nil
+}
+
+// write moves the content at source to p, stashing the file p replaces.
+func (b *batch) write(source, p string) error {
+	if err := b.replace(p); err != nil {
+		return err
+	}
+
+	if err := copyFile(source, b.abs(p)); err != nil {
+		return err
+	}
+
+	b.paths = append(b.paths, p)
+
+	return nil
+}
+
+// restore writes the content of f at its path with the mode of its tree entry, stashing the file it replaces.
+func (b *batch) restore(f *object.File) error {
+	content, err := f.Contents()
+
+	if err != nil {
+		return err
+	}
+
+	if err := b.replace(f.Name); err != nil {
+		return err
+	}
+
+	if err := b.gfs.Processor.writeFile(f.Name, []byte(content), f.Mode); err != nil {
+		return err
+	}
+
+	b.paths = append(b.paths, f.Name)
+
+	return nil
+}
+
+// replace makes room for a new file at p: it stashes the file there, if any, and creates its missing parents.
+func (b *batch) replace(p string) error {
+	if info, err := os.Lstat(b.abs(p)); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("\"%v\" is a directory: %w", p, fs.ErrExist)
+		}
+
+		if err := b.stash(p); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := b.mkdir(path.Dir(p)); err != nil {
+		return err
+	}
+
+	b.undo = append(b.undo, func() error { return os.RemoveAll(b.abs(p)) })
+
+	return nil
+}
+
+func (b *batch) rollback() {
+	for i := len(b.undo) - 1; i >= 0; i-- {
+		if err := b.undo[i](); err != nil {
+			log.Println(fmt.Errorf("failed to roll back batch step: %w", err))
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,205 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Branch describes a branch known locally, on the remote, or both.
+type Branch struct {
+	Name    string `json:"name"`
+	Head    string `json:"head"`    // Head is the local commit, or the remote one for remote-only branches.
+	Local   bool   `json:"local"`   // Local is set if the branch exists in the clone.
+	Remote  bool   `json:"remote"`  // Remote is set if the branch exists on the remote, as of the last fetch.
+	Current bool   `json:"current"` // Current is set for the drive's working branch.
+}
+
+// checkout switches an existing clone to branch b, creating it from the remote branch if needed.
+// An empty branch keeps the clone on its current branch.
+func checkout(repo *git.Repository, remote, b string) error {
+	if b == "" {
+		return nil
+	}
+
+	ref := plumbing.NewBranchReferenceName(b)
+
+	if head, err := repo.Head(); err == nil && head.Name() == ref {
+		return nil
+	}
+
+	w, err := repo.Worktree()
+
+	if err != nil {
+		return err
+	}
+
+	opts := &git.CheckoutOptions{Branch: ref}
+
+	if _, err := repo.Reference(ref, false); err == plumbing.ErrReferenceNotFound {
+		rref, err := repo.Reference(plumbing.NewRemoteReferenceName(remote, b), true)
+
+		if err != nil {
+			return fmt.Errorf("failed to find branch \"%v\": %w", b, err)
+		}
+
+		opts.Hash = rref.Hash()
+		opts.Create = true
+	}
+
+	if err := w.Checkout(opts); err != nil {
+		return fmt.Errorf("failed to checkout branch \"%v\": %w", b, err)
+	}
+
+	return nil
+}
+
+// Branches lists the local branches and the remote ones fetched from the drive's remote.
+func (gc *GitClient) Branches() ([]Branch, error) {
+	return call(gc, gc.branches)
+}
+
+func (gc *GitClient) branches() ([]Branch, error) {
+	branches := map[string]*Branch{}
+	current := ""
+
+	if head, err := gc.repo.Head(); err == nil && head.Name().IsBranch() {
+		current = head.Name().Short()
+	}
+
+	refs, err := gc.repo.References()
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "refs/remotes/" + gc.remote + "/"
+
+	err = refs.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		var name string
+		local := r.Name().IsBranch()
+
+		if local {
+			name = r.Name().Short()
+		} else if strings.HasPrefix(r.Name().String(), prefix) {
+			name = strings.TrimPrefix(r.Name().String(), prefix)
+		} else {
+			return nil
+		}
+
+		b, ok := branches[name]
+
+		if !ok {
+			b = &Branch{Name: name, Head: r.Hash().String(), Current: name == current}
+			branches[name] = b
+		}
+
+		if local {
+			b.Local = true
+			b.Head = r.Hash().String()
+		} else {
+			b.Remote = true
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Branch, 0, len(branches))
+
+	for _, b := range branches {
+		list = append(list, *b)
+	}
+
+	slices.SortFunc(list, func(a, b Branch) int { return strings.Compare(a.Name, b.Name) })
+
+	return list, nil
+}
+
+// CreateBranch creates the branch name at the current HEAD and pushes it to the remote.
+// If the push fails, the branch is not kept locally either. The working branch is not switched.
+func (gc *GitClient) CreateBranch(name string) (*Branch, error) {
+	return call(gc, func() (*Branch, error) { return gc.createBranch(name) })
+}
+
+func (gc *GitClient) createBranch(name string) (*Branch, error) {
+	ref := plumbing.NewBranchReferenceName(name)
+
+	if err := ref.Validate(); err != nil || strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("invalid branch name \"%v\": %w", name, fs.ErrInvalid)
+	}
+
+	if _, err := gc.repo.Reference(ref, false); err == nil {
+		return nil, fmt.Errorf("branch \"%v\": %w", name, fs.ErrExist)
+	}
+
+	head, err := gc.repo.Head()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gc.repo.Storer.SetReference(plumbing.NewHashReference(ref, head.Hash())); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PUSH_TIMEOUT*time.Second)
+	defer cancel()
+
+	err = gc.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: gc.remote,
+		Auth:       gc.auth,
+		RefSpecs:   []config.RefSpec{config.RefSpec(ref + ":" + ref)},
+	})
+
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		// the branch is created on both sides or not at all, so creating it again can be retried
+		if rerr := gc.repo.Storer.RemoveReference(ref); rerr != nil {
+			log.Println(fmt.Errorf("failed to remove branch \"%v\": %w", name, rerr))
+		}
+
+		return nil, fmt.Errorf("failed to push branch \"%v\": %w", name, err)
+	}
+
+	return &Branch{Name: name, Head: head.Hash().String(), Local: true, Remote: true}, nil
+}
+
+// URL returns the URL of the drive's remote.
+func (gc *GitClient) URL() string {
+	return gc.url
+}
+
+// Branch returns the drive's working branch: the configured one, or else the branch the clone is on.
+func (gc *GitClient) Branch() string {
+	if gc.branch != "" {
+		return gc.branch
+	}
+
+	b, _ := call(gc, func() (string, error) { return gc.currentBranch(), nil })
+
+	return b
+}
+
+// currentBranch returns the branch HEAD points to, or "" if it is detached.
+func (gc *GitClient) currentBranch() string {
+	if head, err := gc.repo.Head(); err == nil && head.Name().IsBranch() {
+		return head.Name().Short()
+	}
+
+	return ""
+}
@@ -0,0 +1,256 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrNotCancellable is returned when an operation was already pushed, or when undoing it would also undo other changes.
+var ErrNotCancellable = errors.New("operation can no longer be canceled")
+
+// Cancel undoes an operation that was not pushed yet. An operation still waiting to be committed is dropped
+// and its paths restored in the worktree; a committed one is reverted by a new commit attributed to author,
+// which is pushed in its place. Only the operation's author may cancel it.
+// The operation finishes with the "canceled" status.
+func (gc *GitClient) Cancel(id int64, author *Author) error {
+	return gc.do(func() error {
+		return gc.cancel(id, author)
+	})
+}
+
+func (gc *GitClient) cancel(id int64, author *Author) error {
+	cmd, op, ok := gc.ops.get(id)
+
+	if !ok {
+		if _, done := gc.ops.final(id); done {
+			return fmt.Errorf("op %d: %w", id, ErrNotCancellable)
+		}
+
+		return fmt.Errorf("op %d: %w", id, fs.ErrNotExist)
+	}
+
+	if cmd.author != nil && (author == nil || author.Email != cmd.author.Email) {
+		return fmt.Errorf("op %d belongs to %v: %w", id, cmd.author.Email, fs.ErrPermission)
+	}
+
+	switch op.Stage {
+	case "pending", "queue":
+		if err := gc.checkOtherChanges(id, cmd.paths, plumbing.ZeroHash); err != nil {
+			return err
+		}
+
+		head, err := gc.headTree()
+
+		if err != nil {
+			return err
+		}
+
+		// the command may still sit in the channel or a coalescing window; it is skipped once its operation is gone
+		if err := gc.restore(head, cmd.paths); err != nil {
+			return err
+		}
+	case "commit":
+		if err := gc.revert(cmd, op.Hash, author); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("op %d is in stage \"%v\": %w", id, op.Stage, ErrNotCancellable)
+	}
+
+	gc.updateOpStatus(id, "canceled", 100, "")
+	gc.ops.finish(id)
+
+	return nil
+}
+
+// revert commits the paths of cmd back to their content before commit h, and takes cmd out of the push queue.
+func (gc *GitClient) revert(cmd *command, h string, author *Author) error {
+	c, err := gc.repo.CommitObject(plumbing.NewHash(h))
+
+	if err != nil {
+		return fmt.Errorf("failed to read commit %v: %w", h, err)
+	}
+
+	if err := gc.checkOtherChanges(cmd.id, cmd.paths, c.Hash); err != nil {
+		return err
+	}
+
+	parent, err := c.Parent(0)
+
+	if err != nil {
+		return err
+	}
+
+	tree, err := parent.Tree()
+
+	if err != nil {
+		return err
+	}
+
+	if err := gc.restore(tree, cmd.paths); err != nil {
+		return err
+	}
+
+	if err := gc.add(cmd.paths, true); err != nil {
+		return err
+	}
+
+	if _, err := gc.commit("revert: "+cmd.message, author); err != nil {
+		return fmt.Errorf("failed to revert %v: %w", h, err)
+	}
+
+	queued := [][]*command{}
+
+	for gc.queue.Length() > 0 {
+		committed, _ := gc.queue.Dequeue()
+		queued = append(queued, slices.DeleteFunc(committed, func(q *command) bool { return q.id == cmd.id }))
+	}
+
+	// the commit and its revert are pushed together, even if no other operation is queued
+	gc.queue.Enqueue(queued...)
+
+	return nil
+}
+
+// checkOtherChanges fails with ErrNotCancellable if undoing operation id would also undo another change to paths:
+// one of any other operation not committed yet, of another operation committed with it in commit since,
+// or of a commit after since. A zero since only checks the operations not committed yet.
+func (gc *GitClient) checkOtherChanges(id int64, paths []string, since plumbing.Hash) error {
+	overlaps := func(p string) bool {
+		return slices.ContainsFunc(paths, func(q string) bool { return overlap(cleanPath(p), cleanPath(q)) })
+	}
+
+	later := ""
+
+	gc.ops.each(func(other int64, op *Operation) bool {
+		if other == id || !slices.ContainsFunc(op.paths, overlaps) {
+			return false
+		}
+
+		if op.Stage == "pending" || op.Stage == "queue" || (!since.IsZero() && op.Hash == since.String()) {
+			later = fmt.Sprintf("op %d", other)
+		}
+
+		return false
+	})
+
+	if later == "" && !since.IsZero() {
+		head, err := gc.repo.Head()
+
+		if err != nil {
+			return err
+		}
+
+		if head.Hash() != since {
+			from, err := gc.repo.CommitObject(since)
+
+			if err != nil {
+				return err
+			}
+
+			to, err := gc.repo.CommitObject(head.Hash())
+
+			if err != nil {
+				return err
+			}
+
+			changed, err := diffPaths(from, to)
+
+			if err != nil {
+				return err
+			}
+
+			for p := range changed {
+				if overlaps(p) {
+					later = "a later commit"
+					break
+				}
+			}
+		}
+	}
+
+	if later != "" {
+		return fmt.Errorf("op %d: its paths were changed by %v: %w", id, later, ErrNotCancellable)
+	}
+
+	return nil
+}
+
+// headTree returns the tree of the HEAD commit.
+func (gc *GitClient) headTree() (*object.Tree, error) {
+	head, err := gc.repo.Head()
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := gc.repo.CommitObject(head.Hash())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Tree()
+}
+
+// restore puts paths in the worktree back to their content in tree. Paths missing from tree are removed.
+func (gc *GitClient) restore(tree *object.Tree, paths []string) error {
+	for _, p := range paths {
+		p = cleanPath(p)
+		var files []*object.File
+
+		if f, err := tree.File(p); err == nil {
+			files = []*object.File{f}
+		} else if sub, err := tree.Tree(p); err == nil {
+			err := sub.Files().ForEach(func(f *object.File) error {
+				f.Name = path.Join(p, f.Name)
+				files = append(files, f)
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+		} else if err := os.RemoveAll(path.Join(gc.Path, p)); err != nil {
+			return fmt.Errorf("failed to restore \"%v\": %w", p, err)
+		}
+
+		for _, f := range files {
+			content, err := f.Contents()
+
+			if err != nil {
+				return err
+			}
+
+			mode, err := f.Mode.ToOSFileMode()
+
+			if err != nil {
+				return err
+			}
+
+			fp := path.Join(gc.Path, f.Name)
+
+			if err := os.MkdirAll(path.Dir(fp), 0o755); err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(fp, []byte(content), mode.Perm()); err != nil {
+				return fmt.Errorf("failed to restore \"%v\": %w", f.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func cleanPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
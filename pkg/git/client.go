@@ -1,12 +1,24 @@
 package git
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"os"
 	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/prxg22/git-drive/pkg/queue"
@@ -17,126 +29,320 @@ type accepted_errors_set = *struct{}
 const QUEUE_MAX_SIZE = 20
 const PUSH_TIMEOUT = 5
 
+// PULL_INTERVAL is the default interval between fetches of the remote.
+const PULL_INTERVAL = 30 * time.Second
+
+// PULL_MAX_BACKOFF caps the delay between fetches while the remote keeps failing.
+const PULL_MAX_BACKOFF = 10 * time.Minute
+
+// PUSH_MAX_BACKOFF caps the delay between push attempts while the remote keeps failing.
+const PUSH_MAX_BACKOFF = 10 * time.Minute
+
+// SERVER_NAME and SERVER_EMAIL identify the server as committer when the git config sets no identity.
+const SERVER_NAME = "git-drive"
+const SERVER_EMAIL = "git-drive@localhost"
+
 var PULL_ACCEPTED_ERRORS = map[string]accepted_errors_set{"already up-to-date": nil}
 
 // GitClient represents a processor for Git operations.
+// It is safe for concurrent use: a single goroutine, started by NewGitClient, owns the repository,
+// the worktree and the push queue. Everything touching them runs on it, either as a queued command
+// or through do, including the changes the GitFileSystem makes to the worktree, so pulls and merges
+// never interleave with them. Operation state lives in a synchronized registry.
 type GitClient struct {
-	Path   string                 // Path to the Git repository.
-	url    string                 // URL of the remote repository.
-	remote string                 // Name of the remote repository.
-	auth   transport.AuthMethod   // Authentication method for accessing the remote repository.
-	repo   *git.Repository        // Git repository object.
-	queue  *queue.Queue[*command] // Queue of commit commands.
-	cmds   chan *command          // Channel to receive commit commands.
-	out    map[int64]chan *Operation
-	ops    map[int64]*Operation
+	Path     string                       // Path to the Git repository.
+	url      string                       // URL of the remote repository.
+	remote   string                       // Name of the remote repository.
+	branch   string                       // Working branch; empty means the branch the clone is on.
+	auth     transport.AuthMethod         // Authentication method for accessing the remote repository.
+	ops      *registry                    // State of the operations until they finish.
+	cmds     chan *command                // Channel to receive commit commands.
+	reqs     chan func()                  // Requests run on the processing goroutine.
+	syncs    chan chan error              // Requests for an immediate fetch, answered with its result.
+	every    chan time.Duration           // Changes of the fetch interval.
+	repo     *git.Repository              // Git repository object. Owned by the processing goroutine.
+	queue    *queue.Queue[[]*command]     // Commits waiting to be pushed, as the commands each one holds. Owned by the processing goroutine.
+	usage    *usageCache                  // Usage computed for the last seen HEAD. Owned by the processing goroutine.
+	ignores  *ignoreCache                 // Ignore patterns read for the last seen HEAD. Owned by the processing goroutine.
+	signer   *Signer                      // Signer signs the commits; nil leaves them unsigned. Owned by the processing goroutine.
+	coalesce *coalescer                   // Commands waiting for their coalescing window to close. Owned by the processing goroutine.
+	health   atomic.Pointer[RemoteStatus] // Reachability of the remote, as of the last fetch or push.
+	strategy DivergeStrategy              // Strategy reconciling unpushed commits with a diverged remote. Owned by the processing goroutine.
+	closing  sync.RWMutex                 // Guards closed, so no command is sent once Close starts.
+	closed   bool                         // Closed is set by Close; Commit fails with ErrClosed afterwards.
+	stops    chan stop                    // Request to commit and push the pending work and stop processing.
+	stopped  chan struct{}                // Closed once the processing goroutine returned.
 }
 
 type command struct {
 	id      int64
 	message string
 	paths   []string
+	force   bool
+	author  *Author
+}
+
+// CommitOptions describes how the paths of a commit should be staged.
+type CommitOptions struct {
+	Force  bool    // Force stages paths even if they are matched by the ignore rules.
+	Author *Author // Author is the user who made the change; nil attributes it to the server.
+}
+
+// Author identifies the user a change is attributed to. The server always stays the committer.
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
 }
 
-type Operation struct {
-	Stage    string
-	Status   string
-	Progress uint32
-	Data     string
+// email returns the author's email, or "" for the server.
+func (a *Author) email() string {
+	if a == nil {
+		return ""
+	}
+
+	return a.Email
+}
+
+// GitHubURL builds the URL of a GitHub repository from its owner and name.
+// SSH keys get an SSH URL, any other authentication method an HTTPS one.
+func GitHubURL(owner, repo string, auth transport.AuthMethod) string {
+	switch auth.(type) {
+	case *ssh.PublicKeys:
+		return fmt.Sprintf("git@github.com:%v/%v.git", owner, repo)
+	default:
+		return fmt.Sprintf("https://github.com/%v/%v", owner, repo)
+	}
 }
 
 // NewGitClient creates a new instance of GitProcessor with the specified parameters.
 // It initializes the GitProcessor struct and starts a goroutine to process the commands.
-// The owner and repo parameters specify the GitHub repository to work with.
+// The url parameter is the remote repository in any form git understands: ssh, https, file:// or a local path.
 // The remote parameter specifies the remote name of the repository.
+// The branch parameter specifies the working branch used by clone, pull and push; empty keeps the clone's current branch.
 // The basePath parameter specifies the base path of the local repository.
 // The auth parameter specifies the authentication method to use when interacting with the repository.
-// It returns a pointer to the created GitProcessor instance.
-func NewGitClient(owner, repo, remote, basePath string, auth transport.AuthMethod) *GitClient {
-	var url string
+// Operations left unfinished by a previous run, as recorded in the repository's journal, are resumed.
+// It returns a pointer to the created GitProcessor instance, or an error if the repository cannot be cloned
+// or opened, or its journal read.
+func NewGitClient(url, remote, branch, basePath string, auth transport.AuthMethod) (*GitClient, error) {
+	q := queue.NewQueue[[]*command](QUEUE_MAX_SIZE)
+	r, err := open(basePath, url, remote, branch, auth)
 
-	switch auth.(type) {
-	case *ssh.PublicKeys:
-		url = fmt.Sprintf("git@github.com:%v/%v.git", owner, repo)
-	default:
-		url = fmt.Sprintf("https://github.com/%v/%v", owner, repo)
+	if err != nil {
+		return nil, err
 	}
 
-	q := queue.NewQueue[*command](QUEUE_MAX_SIZE)
-	r, err := open(basePath, url, remote, auth)
+	ops, unfinished, err := openRegistry(basePath)
 
 	if err != nil {
-		log.Panic(err.Error())
+		return nil, err
 	}
 
-	cmds := make(chan *command, QUEUE_MAX_SIZE)
-	out := make(map[int64]chan *Operation)
-	ops := make(map[int64]*Operation)
-
 	gc := &GitClient{
-		Path:   path.Clean(basePath),
-		auth:   auth,
-		cmds:   cmds,
-		queue:  q,
-		repo:   r,
-		out:    out,
-		ops:    ops,
-		remote: remote,
-		url:    url,
+		Path:     path.Clean(basePath),
+		auth:     auth,
+		cmds:     make(chan *command, QUEUE_MAX_SIZE),
+		reqs:     make(chan func()),
+		queue:    q,
+		repo:     r,
+		ops:      ops,
+		coalesce: newCoalescer(),
+		strategy: DIVERGE_MERGE,
+		syncs:    make(chan chan error),
+		every:    make(chan time.Duration),
+		stops:    make(chan stop),
+		stopped:  make(chan struct{}),
+		remote:   remote,
+		branch:   branch,
+		url:      url,
 	}
 
-	go gc.process()
+	gc.health.Store(&RemoteStatus{Online: true, Since: time.Now()})
 
-	return gc
+	go gc.process(gc.resume(unfinished))
+
+	return gc, nil
 }
 
 // Commit adds and commits changes asynchronously. It takes a commit message and a list of paths to files that have been changed.
 // The function creates a commit command and sends it to the command channel for processing.
-// It returns the ID of the commit operation for tracking purposes.
-func (gc *GitClient) Commit(message string, paths []string) (int64, error) {
-	cmd := &command{
-		time.Now().UnixMilli(),
-		message,
-		paths,
+// It returns the ID of the commit operation for tracking purposes, or ErrClosed once the client is closed.
+func (gc *GitClient) Commit(message string, paths []string, opts *CommitOptions) (int64, error) {
+	gc.closing.RLock()
+	defer gc.closing.RUnlock()
+
+	if gc.closed {
+		return -1, ErrClosed
 	}
 
-	go func() {
-		gc.cmds <- cmd
-	}()
+	if opts == nil {
+		opts = &CommitOptions{}
+	}
 
-	out := make(chan *Operation, QUEUE_MAX_SIZE)
-	gc.out[cmd.id] = out
-	gc.ops[cmd.id] = &Operation{
-		Stage: "pending",
+	cmd := &command{
+		message: message,
+		paths:   paths,
+		force:   opts.Force,
+		author:  opts.Author,
 	}
 
+	gc.ops.create(cmd)
 	err := gc.updateOpStage(cmd.id, "queue", 0)
+	gc.cmds <- cmd
 
 	return cmd.id, err
 }
 
+// begin registers the operation of a change to paths before the change touches the worktree,
+// so the watcher leaves the paths to it. It must run on the processing goroutine, and be followed
+// by submit once the change is made or by abort if it could not be.
+func (gc *GitClient) begin(message string, paths []string, opts *CommitOptions) *command {
+	if opts == nil {
+		opts = &CommitOptions{}
+	}
+
+	cmd := &command{
+		message: message,
+		paths:   paths,
+		force:   opts.Force,
+		author:  opts.Author,
+	}
+
+	gc.ops.create(cmd)
+
+	return cmd
+}
+
+// submit queues the command of a change made on the processing goroutine, as Commit does from other goroutines.
+// The operation's paths are updated to the command's, which the change may have extended.
+func (gc *GitClient) submit(cmd *command) {
+	gc.enqueue(cmd)
+	gc.accept(cmd)
+}
+
+// commitNow commits the command of a change made on the processing goroutine right away, without coalescing,
+// so the caller can undo the change if committing it fails. The operation is failed then.
+func (gc *GitClient) commitNow(cmd *command) error {
+	gc.enqueue(cmd)
+	return gc.processCmds([]*command{cmd})
+}
+
+// enqueue moves the operation of cmd to the queue stage, with the paths of cmd.
+func (gc *GitClient) enqueue(cmd *command) {
+	gc.ops.update(cmd.id, func(op *Operation) {
+		op.Stage = "queue"
+		op.Status = "pending"
+		op.paths = cmd.paths
+	})
+}
+
+// abort fails the operation of a change that could not be made.
+func (gc *GitClient) abort(cmd *command, err error) {
+	gc.updateOpStatus(cmd.id, "failed", -1, err.Error())
+	gc.ops.finish(cmd.id)
+}
+
+// accept commits cmd right away, or holds it in its author's burst when coalescing.
+func (gc *GitClient) accept(cmd *command) {
+	if gc.coalesce.window > 0 {
+		gc.coalesce.add(cmd)
+	} else {
+		gc.processCmds([]*command{cmd})
+	}
+}
+
+// do runs f on the processing goroutine and returns its error, or ErrClosed if it stopped.
+// It must not be called from that goroutine.
+func (gc *GitClient) do(f func() error) error {
+	done := make(chan error, 1)
+
+	select {
+	case gc.reqs <- func() { done <- f() }:
+		return <-done
+	case <-gc.stopped:
+		return ErrClosed
+	}
+}
+
+// change runs f, which changes the worktree and returns the id of the operation committing it,
+// on the processing goroutine. It fails with ErrClosed once Close was called, like Commit.
+func (gc *GitClient) change(f func() (int64, error)) (int64, error) {
+	gc.closing.RLock()
+	defer gc.closing.RUnlock()
+
+	if gc.closed {
+		return -1, ErrClosed
+	}
+
+	return call(gc, f)
+}
+
+// call runs f on the processing goroutine and returns its results.
+func call[T any](gc *GitClient, f func() (T, error)) (T, error) {
+	var v T
+
+	err := gc.do(func() (err error) {
+		v, err = f()
+		return err
+	})
+
+	return v, err
+}
+
+// Sync fetches and merges the remote immediately, instead of waiting for the next scheduled fetch.
+func (gc *GitClient) Sync() error {
+	done := make(chan error, 1)
+
+	select {
+	case gc.syncs <- done:
+		return <-done
+	case <-gc.stopped:
+		return ErrClosed
+	}
+}
+
+// PullEvery sets the interval between scheduled fetches of the remote. It defaults to PULL_INTERVAL.
+func (gc *GitClient) PullEvery(interval time.Duration) {
+	select {
+	case gc.every <- interval:
+	case <-gc.stopped:
+	}
+}
+
+// ListenOperation returns a channel receiving the operation's state and its updates, closed once it finishes.
+// Every call returns a new channel, so an operation can have several listeners.
 func (gc *GitClient) ListenOperation(id int64) chan *Operation {
-	return gc.out[id]
+	return gc.ops.listen(id)
 }
 
-func open(p, u, r string, a transport.AuthMethod) (*git.Repository, error) {
+func open(p, u, r, b string, a transport.AuthMethod) (*git.Repository, error) {
 	repo, err := git.PlainOpen(p)
 
 	if err == git.ErrRepositoryNotExists {
-		return clone(p, u, r, a)
+		return clone(p, u, r, b, a)
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
 
+	if err := checkout(repo, r, b); err != nil {
+		return nil, err
+	}
+
 	return repo, nil
 }
 
-func clone(p, u, r string, a transport.AuthMethod) (*git.Repository, error) {
-	repo, err := git.PlainClone(p, false, &git.CloneOptions{
+func clone(p, u, r, b string, a transport.AuthMethod) (*git.Repository, error) {
+	opts := &git.CloneOptions{
 		URL:        u,
 		Auth:       a,
 		RemoteName: r,
-	})
+	}
+
+	if b != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(b)
+	}
+
+	repo, err := git.PlainClone(p, false, opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to open repository: %w", err)
@@ -145,6 +351,7 @@ func clone(p, u, r string, a transport.AuthMethod) (*git.Repository, error) {
 	return repo, nil
 }
 
+// pull fetches and merges the working branch, giving up on the remote after PUSH_TIMEOUT seconds.
 func (gc *GitClient) pull() error {
 	w, err := gc.repo.Worktree()
 	if err != nil {
@@ -156,26 +363,68 @@ func (gc *GitClient) pull() error {
 		Auth:       gc.auth,
 	}
 
-	dff := w.Pull(opts)
-	if dff != nil {
+	if gc.branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(gc.branch)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PUSH_TIMEOUT*time.Second)
+	defer cancel()
+
+	dff := w.PullContext(ctx, opts)
+	gc.reached(dff)
+
+	if dff == git.ErrNonFastForwardUpdate {
+		conflicts, err := gc.diverged()
+		if errors.Is(err, ErrUnresolvedDivergence) {
+			gc.reportDivergence(err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reconcile diverged remote: %w", err)
+		}
+		for _, c := range conflicts {
+			log.Printf("conflict on \"%v\", local version saved as \"%v\"\n", c.Path, c.Copy)
+		}
+	} else if dff != nil {
 		if _, acceptable := PULL_ACCEPTED_ERRORS[dff.Error()]; !acceptable {
-			return fmt.Errorf("failed to pull working tree: %w", err)
+			return fmt.Errorf("failed to pull working tree: %w", dff)
 		}
 	}
 
 	return nil
 }
 
-func (gc *GitClient) add(paths []string) error {
+// add stages the given paths. Paths matched by the ignore rules fail with ErrIgnoredPath unless force is set,
+// and deleted paths that were never tracked are skipped as there is nothing to stage.
+func (gc *GitClient) add(paths []string, force bool) error {
 	w, err := gc.repo.Worktree()
 
 	if err != nil {
 		return err
 	}
 
+	m, err := gc.ignoreMatcher()
+
+	if err != nil {
+		return fmt.Errorf("error reading ignore rules: %w", err)
+	}
+
+	idx, err := gc.repo.Storer.Index()
+
+	if err != nil {
+		return err
+	}
+
 	for _, p := range paths {
-		if err != nil {
+		info, err := w.Filesystem.Lstat(p)
+
+		if os.IsNotExist(err) {
+			if _, err := idx.Entry(p); err == index.ErrEntryNotFound {
+				continue
+			}
+		} else if err != nil {
 			return fmt.Errorf("error getting path %s stats: %w", p, err)
+		} else if !force && m.Match(splitPath(p), info.IsDir()) {
+			return fmt.Errorf("error adding path %s: %w", p, ErrIgnoredPath)
 		}
 
 		_, err = w.Add(p)
@@ -189,134 +438,354 @@ func (gc *GitClient) add(paths []string) error {
 	return nil
 }
 
-func (gc *GitClient) commit(message string) error {
+// commit commits the staged changes and returns the hash of the commit, signed if the client has a signer.
+func (gc *GitClient) commit(message string, author *Author) (plumbing.Hash, error) {
 	w, err := gc.repo.Worktree()
 
 	if err != nil {
-		return err
+		return plumbing.ZeroHash, err
 	}
 
-	if _, err = w.Commit(message, &git.CommitOptions{}); err != nil {
-		return err
+	committer := gc.identity()
+	opts := &git.CommitOptions{Author: committer, Committer: committer}
+
+	if author != nil && author.Email != "" {
+		opts.Author = &object.Signature{Name: author.Name, Email: author.Email, When: committer.When}
 	}
 
-	return nil
+	return gc.commitSigned(w, message, opts)
 }
 
-func (gc *GitClient) push() error {
-	return gc.repo.Push(&git.PushOptions{
-		RemoteName: gc.remote,
-		Auth:       gc.auth,
-	})
-}
+// identity returns the server's signature, read from the committer or user of the git config
+// and falling back to SERVER_NAME and SERVER_EMAIL.
+func (gc *GitClient) identity() *object.Signature {
+	sig := &object.Signature{Name: SERVER_NAME, Email: SERVER_EMAIL, When: time.Now()}
+
+	cfg, err := gc.repo.ConfigScoped(config.SystemScope)
 
-func (gc *GitClient) updateOp(id int64, stage string, pgrss uint32, status string, data string) error {
-	p, exists := gc.ops[id]
+	if err != nil {
+		log.Println(fmt.Errorf("failed to read git config, committing as %v: %w", SERVER_EMAIL, err))
+		return sig
+	}
 
-	if !exists {
-		return fmt.Errorf("progress %d doesn't exist in progress map", id)
+	if cfg.Committer.Name != "" && cfg.Committer.Email != "" {
+		sig.Name, sig.Email = cfg.Committer.Name, cfg.Committer.Email
+	} else if cfg.User.Name != "" && cfg.User.Email != "" {
+		sig.Name, sig.Email = cfg.User.Name, cfg.User.Email
 	}
 
-	out, exists := gc.out[id]
+	return sig
+}
+
+// push pushes the working branch, giving up once ctx is done or after PUSH_TIMEOUT seconds,
+// so an unreachable remote does not hold the processing goroutine.
+func (gc *GitClient) push(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, PUSH_TIMEOUT*time.Second)
+	defer cancel()
 
-	if !exists {
-		return fmt.Errorf("out channel %d doesn't exist in progress map", id)
+	opts := &git.PushOptions{
+		RemoteName: gc.remote,
+		Auth:       gc.auth,
 	}
-	p.Progress = pgrss
-	p.Stage = stage
-	p.Status = status
-	p.Data = data
-	out <- p
-	return nil
+
+	if gc.branch != "" {
+		ref := plumbing.NewBranchReferenceName(gc.branch)
+		opts.RefSpecs = []config.RefSpec{config.RefSpec(ref + ":" + ref)}
+	}
+
+	return gc.repo.PushContext(ctx, opts)
 }
 
+// updateOpStatus sets the status of the operation. A negative progress keeps the current one.
 func (gc *GitClient) updateOpStatus(id int64, status string, p int32, data string) error {
-	if op, ok := gc.ops[id]; ok {
-		prgss := uint32(p)
-
-		if p < 0 {
-			prgss = op.Progress
+	found := gc.ops.update(id, func(op *Operation) {
+		if p >= 0 {
+			op.Progress = uint32(p)
 		}
+		op.Status = status
+		op.Data = data
+	})
 
-		return gc.updateOp(id, op.Stage, prgss, status, data)
-	} else {
+	if !found {
 		return fmt.Errorf("op %d not found", id)
 	}
+
+	return nil
 }
 
+// updateOpStage moves the pending operation to stage.
 func (gc *GitClient) updateOpStage(id int64, stage string, p uint32) error {
-	if op, ok := gc.ops[id]; ok {
-		return gc.updateOp(id, stage, p, "pending", op.Data)
-	} else {
+	found := gc.ops.update(id, func(op *Operation) {
+		op.Stage = stage
+		op.Progress = p
+		op.Status = "pending"
+	})
+
+	if !found {
 		return fmt.Errorf("op %d not found", id)
 	}
+
+	return nil
 }
 
-// processCmd processes the commit command.
-// It adds the specified paths to the Git repository and commits the changes with the given message.
-// Returns an error if any operation fails.
-func (gc *GitClient) processCmd(cmd *command) error {
-	paths := cmd.paths
-	if err := gc.add(paths); err != nil {
-		gc.updateOpStatus(cmd.id, "failed", -1, err.Error())
-		return err
+// processCmds processes commit commands that share an author.
+// It adds the paths of every command to the Git repository and commits them together, joining their messages.
+// A command whose paths cannot be added fails on its own; the others are still committed.
+// Every committed operation records the hash of the shared commit.
+// Returns the first error encountered.
+func (gc *GitClient) processCmds(cmds []*command) error {
+	var failure error
+	staged := make([]*command, 0, len(cmds))
+
+	for _, cmd := range cmds {
+		// canceled while it waited
+		if _, _, ok := gc.ops.get(cmd.id); !ok {
+			continue
+		}
+
+		if err := gc.add(cmd.paths, cmd.force); err != nil {
+			gc.updateOpStatus(cmd.id, "failed", -1, err.Error())
+			gc.ops.finish(cmd.id)
+			failure = cmp.Or(failure, err)
+			continue
+		}
+
+		gc.updateOpStage(cmd.id, "add", 33)
+		staged = append(staged, cmd)
 	}
-	gc.updateOpStage(cmd.id, "add", 33)
 
-	if err := gc.commit(cmd.message); err != nil {
-		gc.updateOpStatus(cmd.id, "failed", -1, err.Error())
-		return err
+	if len(staged) == 0 {
+		return failure
 	}
-	gc.updateOpStage(cmd.id, "commit", 66)
 
-	gc.queue.Enqueue(cmd)
-	return nil
+	messages := make([]string, len(staged))
+
+	for i, cmd := range staged {
+		messages[i] = cmd.message
+	}
+
+	h, err := gc.commit(strings.Join(messages, " | "), staged[0].author)
+
+	for _, cmd := range staged {
+		if err != nil {
+			gc.updateOpStatus(cmd.id, "failed", -1, err.Error())
+			gc.ops.finish(cmd.id)
+			continue
+		}
+
+		gc.ops.update(cmd.id, func(op *Operation) {
+			op.Stage = "commit"
+			op.Progress = 66
+			op.Status = "pending"
+			op.Hash = h.String()
+		})
+	}
+
+	if err != nil {
+		return cmp.Or(failure, err)
+	}
+
+	// push before the queue overwrites its oldest commit, which would never be reported
+	if gc.queue.IsFull() {
+		if err := gc.pushCmds(context.Background()); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// offline, the queue stays full: the two oldest commits are tracked as one, as they are pushed together anyway
+	if gc.queue.IsFull() {
+		first, _ := gc.queue.Dequeue()
+		second, _ := gc.queue.Dequeue()
+		rest := [][]*command{}
+
+		for gc.queue.Length() > 0 {
+			committed, _ := gc.queue.Dequeue()
+			rest = append(rest, committed)
+		}
+
+		gc.queue.Enqueue(append(first, second...))
+		gc.queue.Enqueue(rest...)
+	}
+
+	gc.queue.Enqueue(staged)
+	return failure
 }
 
-func (gc *GitClient) pushCmds() error {
-	for cmd := range gc.queue.Iterate() {
-		gc.updateOpStage(cmd.id, "push", 69)
-		gc.queue.Enqueue(cmd)
+// pushCmds pushes the committed commands and finishes their operations.
+// If the push fails, the commits stay queued for the next attempt and their operations
+// go back to the commit stage with the "committed" status, awaiting push.
+func (gc *GitClient) pushCmds(ctx context.Context) error {
+	if gc.queue.Length() == 0 {
+		return nil
 	}
 
-	if err := gc.push(); err == nil {
-		for cmd := range gc.queue.Iterate() {
-			gc.updateOpStatus(cmd.id, "success", 100, "")
+	queued := [][]*command{}
+
+	for gc.queue.Length() > 0 {
+		committed, _ := gc.queue.Dequeue()
+		queued = append(queued, committed)
 
-			defer delete(gc.out, cmd.id)
-			defer delete(gc.ops, cmd.id)
-			defer close(gc.out[cmd.id])
+		for _, cmd := range committed {
+			gc.updateOpStage(cmd.id, "push", 69)
 		}
-	} else if err.Error() != "already up-to-date" {
-		for cmd := range gc.queue.Iterate() {
-			gc.updateOpStatus(cmd.id, "falied", -1, err.Error())
+	}
+
+	err := gc.push(ctx)
+
+	if err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
 
-			defer delete(gc.out, cmd.id)
-			defer delete(gc.ops, cmd.id)
-			defer close(gc.out[cmd.id])
+	gc.reached(err)
+
+	if err != nil {
+		gc.queue.Enqueue(queued...)
+	}
+
+	for _, committed := range queued {
+		for _, cmd := range committed {
+			if err != nil {
+				gc.ops.update(cmd.id, func(op *Operation) {
+					op.Stage = "commit"
+					op.Progress = 66
+					op.Status = "committed"
+					op.Data = err.Error()
+				})
+				continue
+			}
+
+			gc.updateOpStatus(cmd.id, "success", 100, "")
+			gc.ops.finish(cmd.id)
 		}
-		return err
 	}
 
-	return nil
+	return err
+}
+
+// backoff returns the delay before the next attempt: the interval, doubled for every consecutive failure
+// up to limit, plus up to a fifth of it as jitter so drives sharing a remote spread their fetches and pushes.
+func backoff(interval time.Duration, failures int, limit time.Duration) time.Duration {
+	d := interval
+
+	for i := 0; i < failures && d < limit; i++ {
+		d *= 2
+	}
+
+	d = min(d, max(limit, interval))
+
+	return d + time.Duration(rand.Int64N(int64(d)/5+1))
 }
 
 // process is a method of the GitProcessor struct that continuously processes commands from the cmds channel.
 // It also handles pushing and pulling changes to and from the remote repository.
-// This method runs in an infinite loop until the program is terminated.
-func (gc *GitClient) process() {
+// Fetches run on a timer, backing off while the remote fails, or right away when Sync is called.
+// Pushes back off the same way, and are retried right away once a fetch reaches the remote again.
+// With a coalescing window, commands are held per author and committed together once their window closes.
+// The resumed commands are processed, and the commits left unpushed are pushed, before anything else.
+// This method runs in a loop until Close stops it.
+func (gc *GitClient) process(resumed []*command) {
+	defer close(gc.stopped)
+
+	interval := PULL_INTERVAL
+	failures := 0
+
 	pushTimer := time.NewTimer(PUSH_TIMEOUT * time.Second)
+	pullTimer := time.NewTimer(backoff(interval, failures, PULL_MAX_BACKOFF))
+
+	pushFailures := 0
+
+	push := func() {
+		err := gc.pushCmds(context.Background())
+		d := PUSH_TIMEOUT * time.Second
+
+		if err != nil {
+			pushFailures++
+			d = backoff(d, pushFailures, PUSH_MAX_BACKOFF)
+			log.Println(fmt.Errorf("error while processor try to push, retrying in %v: %w", d.Round(time.Second), err))
+		} else {
+			pushFailures = 0
+		}
+
+		pushTimer.Reset(d)
+	}
+
+	schedule := func() time.Duration {
+		if !pullTimer.Stop() {
+			select {
+			case <-pullTimer.C:
+			default:
+			}
+		}
+
+		d := backoff(interval, failures, PULL_MAX_BACKOFF)
+		pullTimer.Reset(d)
+
+		return d
+	}
+
+	commitAll := func(batches [][]*command) {
+		for _, cmds := range batches {
+			gc.processCmds(cmds)
+		}
+	}
+
+	pull := func() error {
+		// the worktree must be clean to merge the remote
+		commitAll(gc.coalesce.flush(time.Now(), true))
+
+		err := gc.pull()
+
+		if err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		// the remote is back: retry the push now rather than at the end of its backoff
+		if pushFailures > 0 && gc.health.Load().Online {
+			if !pushTimer.Stop() {
+				select {
+				case <-pushTimer.C:
+				default:
+				}
+			}
+			pushTimer.Reset(0)
+		}
+
+		if d := schedule(); err != nil {
+			log.Println(fmt.Errorf("error while processor try to pull, retrying in %v: %w", d.Round(time.Second), err))
+		}
+
+		return err
+	}
+
+	for _, cmd := range resumed {
+		gc.processCmds([]*command{cmd})
+	}
+
+	if err := gc.repush(); err != nil {
+		log.Println(fmt.Errorf("error while processor try to push unpushed commits: %w", err))
+	}
+
 	for {
 		select {
 		case cmd := <-gc.cmds:
-			go gc.processCmd(cmd)
+			gc.accept(cmd)
+		case <-gc.coalesce.timer.C:
+			commitAll(gc.coalesce.flush(time.Now(), false))
 		case <-pushTimer.C:
-			pushTimer.Reset(PUSH_TIMEOUT * time.Second)
-			go gc.pushCmds()
-		default:
-			if err := gc.pull(); err != nil && err.Error() != "already up-to-date" {
-				log.Println(fmt.Errorf("error while processor try to pull: %w", err))
-			}
+			push()
+		case f := <-gc.reqs:
+			f()
+		case <-pullTimer.C:
+			pull()
+		case done := <-gc.syncs:
+			done <- pull()
+		case interval = <-gc.every:
+			schedule()
+		case s := <-gc.stops:
+			s.done <- gc.shutdown(s.ctx)
+			return
 		}
 	}
 }
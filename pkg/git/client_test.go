@@ -0,0 +1,836 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/prxg22/git-drive/internal/testutil"
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+// newClient opens a client on a clone of url at local, working on branch.
+func newClient(t *testing.T, url, branch, local string) *git.GitClient {
+	t.Helper()
+
+	gc, err := git.NewGitClient(url, "origin", branch, local, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return gc
+}
+
+// waitOperation reads the operation's updates until it finishes and returns the last one.
+func waitOperation(t *testing.T, gc *git.GitClient, id int64) *git.Operation {
+	t.Helper()
+
+	timeout := time.After(3 * git.PUSH_TIMEOUT * time.Second)
+	updates := gc.ListenOperation(id)
+	var last *git.Operation
+
+	for {
+		select {
+		case op, ok := <-updates:
+			if !ok {
+				return last
+			}
+			last = op
+			if op.Status == "success" || op.Status == "failed" {
+				return op
+			}
+		case <-timeout:
+			t.Fatalf("Operation %d timed out, last update %+v", id, last)
+		}
+	}
+}
+
+func TestGitHubURL(t *testing.T) {
+	url := git.GitHubURL("prxg22", "drive", nil)
+	if url != "https://github.com/prxg22/drive" {
+		t.Errorf("Expected https url, got %v", url)
+	}
+}
+
+func TestClientOpenError(t *testing.T) {
+	testutil.WithIdentity(t)
+
+	if _, err := git.NewGitClient("file://"+path.Join(t.TempDir(), "missing.git"), "origin", "", testutil.LocalPath(t), nil); err == nil {
+		t.Errorf("Expected an error cloning a missing remote")
+	}
+}
+
+func TestClientFileRemote(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "dir/b.txt": "b"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+	gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+
+	infos, err := gfs.ReadDir("/", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Errorf("Expected 2 entries, got %v", len(infos))
+	}
+
+	id, err := gfs.Remove("dir", &git.Author{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if op := waitOperation(t, gc, id); op == nil || op.Status != "success" {
+		t.Fatalf("Expected operation to succeed, got %+v", op)
+	}
+
+	remote, err := gogit.PlainOpen(url[len("file://"):])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	head, err := remote.Head()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	commit, err := remote.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if commit.Message != "rm: dir/b.txt" {
+		t.Errorf("Expected remote head to be the removal, got %q", commit.Message)
+	}
+
+	if _, err := commit.File("dir/b.txt"); err == nil {
+		t.Errorf("Expected dir/b.txt to be removed from the remote")
+	}
+
+	if commit.Author.Email != "alice@example.com" || commit.Author.Name != "Alice" {
+		t.Errorf("Expected the request user as author, got %v", commit.Author)
+	}
+
+	if commit.Committer.Email != "drive@example.com" {
+		t.Errorf("Expected the server as committer, got %v", commit.Committer)
+	}
+}
+
+func TestClientBranches(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+
+	if _, err := gc.CreateBranch("feature"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := gc.CreateBranch("feature"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist, got %v", err)
+	}
+
+	if _, err := gc.CreateBranch("bad..name"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Expected fs.ErrInvalid, got %v", err)
+	}
+
+	branches, err := gc.Branches()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	found := false
+	for _, b := range branches {
+		if b.Name == "feature" {
+			found = b.Local && !b.Current
+		}
+	}
+	if !found {
+		t.Errorf("Expected a local, not current feature branch, got %+v", branches)
+	}
+
+	b, _, err := gc.ReadFileAt("feature", "a.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(b) != "a" {
+		t.Errorf("Expected \"a\", got %q", b)
+	}
+
+	reopened := newClient(t, url, "feature", testutil.LocalPath(t))
+
+	branches, err = reopened.Branches()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, b := range branches {
+		if b.Current != (b.Name == "feature") {
+			t.Errorf("Expected feature to be the current branch, got %+v", branches)
+		}
+	}
+
+	if err := os.RemoveAll(strings.TrimPrefix(url, "file://")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := gc.CreateBranch("unpushed"); err == nil {
+		t.Fatalf("Expected the push to fail")
+	}
+
+	branches, _ = gc.Branches()
+	for _, b := range branches {
+		if b.Name == "unpushed" {
+			t.Errorf("Expected the unpushed branch to be removed, got %+v", b)
+		}
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+
+	other, err := gogit.PlainClone(t.TempDir(), false, &gogit.CloneOptions{URL: url})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w, _ := other.Worktree()
+	if err := os.WriteFile(path.Join(w.Filesystem.Root(), "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := w.Add("b.txt"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	author := &object.Signature{Name: "other", Email: "other@example.com", When: time.Now()}
+	if _, err := w.Commit("add b", &gogit.CommitOptions{Author: author}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := other.Push(&gogit.PushOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := gc.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if b, err := os.ReadFile(path.Join(gc.Path, "b.txt")); err != nil || string(b) != "b" {
+		t.Errorf("Expected b.txt to be pulled, got %q, %v", b, err)
+	}
+}
+
+func TestClientConcurrentCommits(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+
+	const n = 8
+	ids := make(chan int64, n)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			p := fmt.Sprintf("file-%d.txt", i)
+			if err := os.WriteFile(path.Join(gc.Path, p), []byte(p), 0o644); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			id, err := gc.Commit("add: "+p, []string{p}, nil)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			ids <- id
+
+			if _, err := gc.History("", 10); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if _, _, err := gc.Usage(); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := map[int64]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("Expected unique operation ids, got %d twice", id)
+		}
+		seen[id] = true
+
+		if op := waitOperation(t, gc, id); op != nil && op.Status != "success" {
+			t.Errorf("Expected operation %d to succeed, got %+v", id, op)
+		}
+	}
+
+	usage, _, err := gc.Usage()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usage.Files != n+1 {
+		t.Errorf("Expected %d committed files, got %v", n+1, usage.Files)
+	}
+}
+
+func TestClientJournal(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "c.txt": "c"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+	gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+
+	id, err := gfs.Remove("a.txt", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if op := waitOperation(t, gc, id); op.Status != "success" {
+		t.Fatalf("Expected success, got %+v", op)
+	}
+
+	// a command the previous run accepted but never committed
+	if err := os.WriteFile(path.Join(local, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record := fmt.Sprintf("{\"id\":%d,\"message\":\"create: b.txt\",\"paths\":[\"b.txt\"],\"stage\":\"queue\",\"status\":\"pending\"}\n", id+1)
+	f, err := os.OpenFile(path.Join(local, ".git", git.JOURNAL_FILE), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.WriteString(record)
+	f.Close()
+
+	restarted := newClient(t, url, "", local)
+
+	if op := waitOperation(t, restarted, id); op == nil || op.Status != "success" {
+		t.Errorf("Expected the finished operation to be kept, got %+v", op)
+	}
+	if op := waitOperation(t, restarted, id+1); op == nil || op.Status != "success" {
+		t.Fatalf("Expected the unfinished operation to be resumed, got %+v", op)
+	}
+
+	repo, err := gogit.PlainOpen(local)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	head, _ := repo.Head()
+	c, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c.Message != "create: b.txt" {
+		t.Errorf("Expected the resumed commit at HEAD, got %v", c.Message)
+	}
+}
+
+func TestClientCoalesce(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+	gc.CoalesceWithin(500 * time.Millisecond)
+	alice := &git.Author{Name: "Alice", Email: "alice@example.com"}
+
+	ids := []int64{}
+
+	for i := 0; i < 3; i++ {
+		p := fmt.Sprintf("f%d.txt", i)
+		if err := os.WriteFile(path.Join(local, p), []byte(p), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		id, err := gc.Commit("create: "+p, []string{p}, &git.CommitOptions{Author: alice})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	hash := ""
+
+	for _, id := range ids {
+		op := waitOperation(t, gc, id)
+		if op.Status != "success" {
+			t.Fatalf("Expected success, got %+v", op)
+		}
+		if hash == "" {
+			hash = op.Hash
+		}
+		if op.Hash == "" || op.Hash != hash {
+			t.Errorf("Expected every operation to resolve to commit %v, got %v", hash, op.Hash)
+		}
+	}
+
+	repo, err := gogit.PlainOpen(local)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	head, _ := repo.Head()
+	if head.Hash().String() != hash {
+		t.Errorf("Expected HEAD at %v, got %v", hash, head.Hash())
+	}
+	c, _ := repo.CommitObject(head.Hash())
+	if c.Message != "create: f0.txt | create: f1.txt | create: f2.txt" {
+		t.Errorf("Expected a combined message, got %v", c.Message)
+	}
+}
+
+// pushFrom commits content at p in a separate clone of url and pushes it.
+func pushFrom(t *testing.T, url, p, content string) {
+	t.Helper()
+
+	other, err := gogit.PlainClone(t.TempDir(), false, &gogit.CloneOptions{URL: url})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	w, _ := other.Worktree()
+	if err := os.MkdirAll(path.Dir(path.Join(w.Filesystem.Root(), p)), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(w.Filesystem.Root(), p), []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := w.Add(p); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	author := &object.Signature{Name: "other", Email: "other@example.com", When: time.Now()}
+	if _, err := w.Commit("edit "+p, &gogit.CommitOptions{Author: author}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := other.Push(&gogit.PushOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// commitLocally commits content at p through gc and waits until it is committed but not pushed yet.
+func commitLocally(t *testing.T, gc *git.GitClient, p, content string) int64 {
+	t.Helper()
+
+	if err := os.WriteFile(path.Join(gc.Path, p), []byte(content), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id, err := gc.Commit("edit: "+p, []string{p}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for op := range gc.ListenOperation(id) {
+		if op.Stage == "commit" {
+			return id
+		}
+	}
+
+	t.Fatalf("Expected operation %d to be committed", id)
+	return id
+}
+
+func TestClientRebase(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+	gc.DivergeWith(git.DIVERGE_REBASE)
+
+	if err := os.Chmod(path.Join(gc.Path, "b.txt"), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pushFrom(t, url, "a.txt", "remote")
+	id := commitLocally(t, gc, "b.txt", "local")
+
+	if err := gc.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	op := waitOperation(t, gc, id)
+	if op.Status != "success" {
+		t.Fatalf("Expected success, got %+v", op)
+	}
+
+	repo, _ := gogit.PlainOpen(gc.Path)
+	head, _ := repo.Head()
+	if op.Hash != head.Hash().String() {
+		t.Errorf("Expected the operation to point at the replayed commit %v, got %v", head.Hash(), op.Hash)
+	}
+
+	c, _ := repo.CommitObject(head.Hash())
+	if c.NumParents() != 1 || c.Message != "edit: b.txt" {
+		t.Errorf("Expected a linear history with the replayed commit, got %v parents and message %q", c.NumParents(), c.Message)
+	}
+	if b, _ := os.ReadFile(path.Join(gc.Path, "a.txt")); string(b) != "remote" {
+		t.Errorf("Expected the remote change, got %q", b)
+	}
+	if info, err := os.Stat(path.Join(gc.Path, "b.txt")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("Expected the replayed file to stay executable, got %v", info.Mode())
+	}
+
+	pushFrom(t, url, "a.txt", "remote again")
+	commitLocally(t, gc, "a.txt", "local")
+
+	if err := gc.Sync(); !errors.Is(err, git.ErrUnresolvedDivergence) {
+		t.Errorf("Expected ErrUnresolvedDivergence, got %v", err)
+	}
+	if b, _ := os.ReadFile(path.Join(gc.Path, "a.txt")); string(b) != "local" {
+		t.Errorf("Expected the local history to be kept, got %q", b)
+	}
+}
+
+func TestClientMergeUntracked(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "b.sh": "b"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+
+	if err := os.Chmod(path.Join(gc.Path, "b.sh"), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(gc.Path, "notes.txt"), []byte("untracked"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pushFrom(t, url, "a.txt", "remote")
+	id := commitLocally(t, gc, "b.sh", "local")
+
+	if err := gc.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if op := waitOperation(t, gc, id); op.Status != "success" {
+		t.Fatalf("Expected success, got %+v", op)
+	}
+
+	if b, _ := os.ReadFile(path.Join(gc.Path, "notes.txt")); string(b) != "untracked" {
+		t.Errorf("Expected the untracked file to be kept, got %q", b)
+	}
+	if info, err := os.Stat(path.Join(gc.Path, "b.sh")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("Expected the replayed file to stay executable, got %v", info.Mode())
+	}
+
+	pushFrom(t, url, "c.txt", "remote")
+	commitLocally(t, gc, "a.txt", "local")
+
+	if err := os.WriteFile(path.Join(gc.Path, "c.txt"), []byte("untracked"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := gc.Sync(); err == nil {
+		t.Errorf("Expected the merge to be postponed by an untracked file the remote changed")
+	}
+	if b, _ := os.ReadFile(path.Join(gc.Path, "c.txt")); string(b) != "untracked" {
+		t.Errorf("Expected the untracked file to be kept, got %q", b)
+	}
+}
+
+func TestClientMergeFailure(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+
+	// the remote makes x a directory while the local change makes it a file, so replaying it fails
+	pushFrom(t, url, "x/y.txt", "remote")
+	commitLocally(t, gc, "x", "local")
+
+	repo, _ := gogit.PlainOpen(gc.Path)
+	local, _ := repo.Head()
+
+	if err := gc.Sync(); err == nil {
+		t.Fatalf("Expected the merge to fail")
+	}
+
+	if head, _ := repo.Head(); head.Hash() != local.Hash() {
+		t.Errorf("Expected HEAD to be restored to %v, got %v", local.Hash(), head.Hash())
+	}
+	if b, _ := os.ReadFile(path.Join(gc.Path, "x")); string(b) != "local" {
+		t.Errorf("Expected the local change to be kept, got %q", b)
+	}
+	if s := gc.RemoteStatus(); s.Unpushed != 1 {
+		t.Errorf("Expected 1 unpushed operation, got %+v", s)
+	}
+}
+
+func TestClientOffline(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	bare := strings.TrimPrefix(url, "file://")
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+
+	if err := os.Rename(bare, bare+".away"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id := commitLocally(t, gc, "b.txt", "offline")
+
+	timeout := time.After(3 * git.PUSH_TIMEOUT * time.Second)
+	updates := gc.ListenOperation(id)
+
+	for committed := false; !committed; {
+		select {
+		case op := <-updates:
+			if op == nil || op.Status == "failed" || op.Status == "success" {
+				t.Fatalf("Expected the operation to await push, got %+v", op)
+			}
+			committed = op.Status == "committed"
+		case <-timeout:
+			t.Fatalf("Operation %d timed out", id)
+		}
+	}
+
+	if s := gc.RemoteStatus(); s.Online || s.Unpushed != 1 {
+		t.Errorf("Expected the remote offline with 1 unpushed operation, got %+v", s)
+	}
+
+	if err := os.Rename(bare+".away", bare); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := gc.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if op := waitOperation(t, gc, id); op.Status != "success" {
+		t.Errorf("Expected the queued commit to be pushed, got %+v", op)
+	}
+	if s := gc.RemoteStatus(); !s.Online || s.Unpushed != 0 {
+		t.Errorf("Expected the remote online with nothing unpushed, got %+v", s)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+	gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+
+	// a listener that never accepts: connections are established but never answered
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	repo, _ := gogit.PlainOpen(gc.Path)
+	cfg, _ := repo.Config()
+	cfg.Remotes["origin"].URLs = []string{"http://" + l.Addr().String() + "/remote.git"}
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	synced := make(chan error, 1)
+	go func() { synced <- gc.Sync() }()
+
+	// let the fetch start before reading
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := gfs.ReadDir("/", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d := time.Since(start); d > (git.PUSH_TIMEOUT+1)*time.Second {
+		t.Errorf("Expected ReadDir to wait for the fetch at most %vs, took %v", git.PUSH_TIMEOUT, d)
+	}
+
+	select {
+	case err := <-synced:
+		if err == nil {
+			t.Errorf("Expected the fetch to fail")
+		}
+	case <-time.After(2 * git.PUSH_TIMEOUT * time.Second):
+		t.Fatalf("Expected the fetch to give up")
+	}
+
+	if s := gc.RemoteStatus(); s.Online {
+		t.Errorf("Expected the remote offline, got %+v", s)
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+
+	committed := commitLocally(t, gc, "b.txt", "local")
+
+	if err := gc.Cancel(committed, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if op := waitOperation(t, gc, committed); op == nil || op.Status != "canceled" {
+		t.Errorf("Expected the committed operation to be canceled, got %+v", op)
+	}
+	if b, _ := os.ReadFile(path.Join(gc.Path, "b.txt")); string(b) != "b" {
+		t.Errorf("Expected b.txt to be reverted, got %q", b)
+	}
+
+	repo, _ := gogit.PlainOpen(gc.Path)
+	head, _ := repo.Head()
+	if c, _ := repo.CommitObject(head.Hash()); c.Message != "revert: edit: b.txt" {
+		t.Errorf("Expected a revert commit at HEAD, got %q", c.Message)
+	}
+
+	gc.CoalesceWithin(time.Hour)
+
+	if err := os.WriteFile(path.Join(gc.Path, "c.txt"), []byte("c"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pending, err := gc.Commit("create: c.txt", []string{"c.txt"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := gc.Cancel(pending, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path.Join(gc.Path, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected c.txt to be removed, got %v", err)
+	}
+
+	if err := gc.Cancel(pending, nil); !errors.Is(err, git.ErrNotCancellable) {
+		t.Errorf("Expected ErrNotCancellable, got %v", err)
+	}
+
+	ids := []int64{}
+
+	for _, content := range []string{"first", "second"} {
+		if err := os.WriteFile(path.Join(gc.Path, "d.txt"), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		id, err := gc.Commit("edit: d.txt", []string{"d.txt"}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids {
+		if err := gc.Cancel(id, nil); !errors.Is(err, git.ErrNotCancellable) {
+			t.Errorf("Expected ErrNotCancellable while the other operation changes d.txt, got %v", err)
+		}
+	}
+	if b, _ := os.ReadFile(path.Join(gc.Path, "d.txt")); string(b) != "second" {
+		t.Errorf("Expected d.txt to be kept, got %q", b)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+	gc.CoalesceWithin(time.Hour)
+
+	if err := os.WriteFile(path.Join(local, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id, err := gc.Commit("create: b.txt", []string{"b.txt"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := gc.Close(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if op := waitOperation(t, gc, id); op.Status != "success" {
+		t.Errorf("Expected the coalesced commit to be pushed on close, got %+v", op)
+	}
+
+	remote, err := gogit.PlainOpen(strings.TrimPrefix(url, "file://"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	head, _ := remote.Head()
+	c, _ := remote.CommitObject(head.Hash())
+	if c.Message != "create: b.txt" {
+		t.Errorf("Expected the remote at the closing commit, got %v", c.Message)
+	}
+
+	if _, err := gc.Commit("create: c.txt", []string{"c.txt"}, nil); !errors.Is(err, git.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if err := gc.Sync(); !errors.Is(err, git.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+	gc.PullEvery(time.Hour)
+
+	if err := gc.Watch(50 * time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(path.Join(local, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	repo, _ := gogit.PlainOpen(local)
+	deadline := time.Now().Add(5 * time.Second)
+	message := ""
+
+	for message != "external: b.txt" && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		head, _ := repo.Head()
+		if c, err := repo.CommitObject(head.Hash()); err == nil {
+			message = c.Message
+		}
+	}
+
+	if message != "external: b.txt" {
+		t.Errorf("Expected the external change to be committed, got %q", message)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := gc.Close(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package git
+
+import (
+	"slices"
+	"time"
+)
+
+// coalescer holds the commands of each author until their coalescing window closes,
+// so a burst of changes becomes one commit per author instead of one per command.
+type coalescer struct {
+	window time.Duration     // window is how long the first command of a burst waits for others; zero disables coalescing.
+	bursts map[string]*burst // bursts by author email; "" holds the server's own commands.
+	timer  *time.Timer       // timer fires when the earliest burst is due.
+}
+
+type burst struct {
+	cmds []*command
+	due  time.Time
+}
+
+func newCoalescer() *coalescer {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	return &coalescer{bursts: make(map[string]*burst), timer: timer}
+}
+
+// CoalesceWithin makes the client hold commands for window before committing, merging the commands
+// of the same author that arrive meanwhile into one commit. Zero, the default, commits every command on its own.
+func (gc *GitClient) CoalesceWithin(window time.Duration) {
+	gc.do(func() error {
+		gc.coalesce.window = window
+		return nil
+	})
+}
+
+// add holds cmd in its author's burst, opening the burst if it is the first of the window.
+func (c *coalescer) add(cmd *command) {
+	key := ""
+
+	if cmd.author != nil {
+		key = cmd.author.Email
+	}
+
+	b, ok := c.bursts[key]
+
+	if !ok {
+		b = &burst{due: time.Now().Add(c.window)}
+		c.bursts[key] = b
+		c.schedule()
+	}
+
+	b.cmds = append(b.cmds, cmd)
+}
+
+// flush removes the bursts due by now, or all of them if all is set, and returns their commands, oldest burst first.
+func (c *coalescer) flush(now time.Time, all bool) [][]*command {
+	due := []*burst{}
+
+	for key, b := range c.bursts {
+		if all || !b.due.After(now) {
+			due = append(due, b)
+			delete(c.bursts, key)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b *burst) int { return a.due.Compare(b.due) })
+	c.schedule()
+
+	cmds := make([][]*command, len(due))
+
+	for i, b := range due {
+		cmds[i] = b.cmds
+	}
+
+	return cmds
+}
+
+// schedule sets the timer to the earliest due burst, stopping it if there is none.
+func (c *coalescer) schedule() {
+	if !c.timer.Stop() {
+		select {
+		case <-c.timer.C:
+		default:
+		}
+	}
+
+	var next time.Time
+
+	for _, b := range c.bursts {
+		if next.IsZero() || b.due.Before(next) {
+			next = b.due
+		}
+	}
+
+	if !next.IsZero() {
+		c.timer.Reset(time.Until(next))
+	}
+}
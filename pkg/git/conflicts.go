@@ -0,0 +1,492 @@
+package git
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// UNTRACKED_DIR is where untracked files are kept, under .git, while a divergence is reconciled.
+const UNTRACKED_DIR = "git-drive-untracked"
+
+// Conflict records a path changed both locally and on the remote.
+// The remote version is kept at Path and the local one is saved at Copy.
+type Conflict struct {
+	Path string `json:"path"`
+	Copy string `json:"copy"`
+}
+
+// localChange is a path changed by unpushed local commits, with its content at the local HEAD.
+type localChange struct {
+	path    string
+	deleted bool
+	hash    plumbing.Hash
+	mode    filemode.FileMode
+	content []byte
+	author  string
+}
+
+// conflictCopyName builds "name (conflict copy <user> <date>).ext" in the same directory as p.
+func conflictCopyName(p, user string, when time.Time) string {
+	dir, base := path.Split(p)
+	ext := path.Ext(base)
+
+	if user == "" {
+		user = "unknown"
+	}
+
+	if ext == base {
+		ext = ""
+	}
+
+	name := fmt.Sprintf("%v (conflict copy %v %v)%v", strings.TrimSuffix(base, ext), user, when.Format("2006-01-02"), ext)
+
+	return path.Join(dir, name)
+}
+
+// diverged resolves a local history that cannot be fast-forwarded onto the remote, following the client's strategy.
+// Nothing is done while the worktree has uncommitted changes to tracked files, or untracked files on a path
+// either side changed; the next pull retries. Other untracked files are set aside meanwhile and put back.
+// Divergences the strategy cannot resolve fail with ErrUnresolvedDivergence.
+func (gc *GitClient) diverged() ([]Conflict, error) {
+	w, err := gc.repo.Worktree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := w.Status()
+
+	if err != nil {
+		return nil, err
+	}
+
+	untracked := []string{}
+
+	for p, s := range status {
+		if s.Worktree == git.Untracked {
+			untracked = append(untracked, p)
+		} else if s.Worktree != git.Unmodified || s.Staging != git.Unmodified {
+			return nil, fmt.Errorf("worktree has uncommitted changes, postponing merge")
+		}
+	}
+
+	head, err := gc.repo.Head()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rref, err := gc.repo.Reference(plumbing.NewRemoteReferenceName(gc.remote, head.Name().Short()), true)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve remote branch: %w", err)
+	}
+
+	local, err := gc.repo.CommitObject(head.Hash())
+
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := gc.repo.CommitObject(rref.Hash())
+
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := local.MergeBase(remote)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%w: no common ancestor", ErrUnresolvedDivergence)
+	}
+
+	if len(untracked) > 0 {
+		restore, err := gc.setAside(untracked, bases[0], local, remote)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer restore()
+	}
+
+	if gc.strategy == DIVERGE_REBASE {
+		return nil, gc.rebase(w, bases[0], local, remote)
+	}
+
+	return gc.merge(w, bases[0], local, remote)
+}
+
+// merge resets the worktree to the remote commit, replays every locally changed path that the remote did not touch,
+// saves the local version of paths changed on both sides as conflict copies, except the locks file which is merged
+// entry by entry so no lock is lost, and records a merge commit
+// whose parents are the local and the remote heads. Conflicts are reported on the pending operations that changed them.
+func (gc *GitClient) merge(w *git.Worktree, base, local, remote *object.Commit) ([]Conflict, error) {
+	changes, err := gc.localChanges(base, local)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remoteChanged, err := diffPaths(base, remote)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Reset(&git.ResetOptions{Commit: remote.Hash, Mode: git.HardReset}); err != nil {
+		return nil, fmt.Errorf("failed to reset to remote: %w", err)
+	}
+
+	conflicts, err := gc.mergeChanges(w, changes, remoteChanged, base, local, remote)
+
+	if err != nil {
+		// put the local history back so nothing is lost
+		if rerr := w.Reset(&git.ResetOptions{Commit: local.Hash, Mode: git.HardReset}); rerr != nil {
+			return nil, fmt.Errorf("%w, and failed to restore local history: %w", err, rerr)
+		}
+
+		return nil, err
+	}
+
+	gc.reportConflicts(conflicts)
+
+	return conflicts, nil
+}
+
+// mergeChanges replays the local changes onto the worktree reset to remote and commits the merge.
+// It returns the conflicts found, and leaves the worktree half merged on error.
+func (gc *GitClient) mergeChanges(w *git.Worktree, changes []localChange, remoteChanged map[string]plumbing.Hash, base, local, remote *object.Commit) ([]Conflict, error) {
+	var err error
+
+	conflicts := []Conflict{}
+	paths := []string{}
+
+	for _, c := range changes {
+		rhash, changedRemotely := remoteChanged[c.path]
+
+		target := c.path
+
+		if changedRemotely {
+			if c.deleted || rhash == c.hash {
+				continue
+			}
+
+			if c.path == LOCKS_FILE {
+				if c.content, err = mergeLocksAt(base, local, remote); err != nil {
+					return nil, err
+				}
+			} else {
+				target = conflictCopyName(c.path, c.author, time.Now())
+				conflicts = append(conflicts, Conflict{c.path, target})
+			}
+		}
+
+		if c.deleted {
+			err = os.Remove(path.Join(gc.Path, target))
+		} else {
+			err = gc.writeFile(target, c.content, c.mode)
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to replay \"%v\": %w", target, err)
+		}
+
+		paths = append(paths, target)
+	}
+
+	if err := gc.add(paths, true); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("merge: %v into %v", remote.Hash.String()[:7], local.Hash.String()[:7])
+
+	if len(conflicts) > 0 {
+		copies := make([]string, len(conflicts))
+		for i, c := range conflicts {
+			copies[i] = c.Copy
+		}
+		message += "\n\nconflict copies: " + strings.Join(copies, " | ")
+	}
+
+	server := gc.identity()
+
+	_, err = gc.commitSigned(w, message, &git.CommitOptions{
+		Author:            server,
+		Committer:         server,
+		Parents:           []plumbing.Hash{local.Hash, remote.Hash},
+		AllowEmptyCommits: true,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	return conflicts, nil
+}
+
+// localChanges returns the paths changed between base and local, with their content and the author
+// of the newest local commit that changed them.
+func (gc *GitClient) localChanges(base, local *object.Commit) ([]localChange, error) {
+	changed, err := diffPaths(base, local)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := local.Tree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	authors, err := authorsSince(base, local)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []localChange{}
+
+	for p, h := range changed {
+		c := localChange{path: p, deleted: h.IsZero(), hash: h, author: authors[p]}
+
+		if !c.deleted {
+			f, err := tree.File(p)
+
+			if err != nil {
+				return nil, err
+			}
+
+			content, err := f.Contents()
+
+			if err != nil {
+				return nil, err
+			}
+
+			c.content = []byte(content)
+			c.mode = f.Mode
+		}
+
+		changes = append(changes, c)
+	}
+
+	slices.SortFunc(changes, func(a, b localChange) int { return strings.Compare(a.path, b.path) })
+
+	return changes, nil
+}
+
+// setAside moves the untracked files out of the worktree, which resetting it would delete, and returns
+// a function putting them back. It fails if one of them is on a path changed between base and local or remote.
+func (gc *GitClient) setAside(untracked []string, base, local, remote *object.Commit) (func(), error) {
+	changed := map[string]plumbing.Hash{}
+
+	for _, c := range []*object.Commit{local, remote} {
+		paths, err := diffPaths(base, c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(changed, paths)
+	}
+
+	for _, u := range untracked {
+		for p := range changed {
+			if overlap(u, p) {
+				return nil, fmt.Errorf("untracked \"%v\" is changed by the diverged history, postponing merge", u)
+			}
+		}
+	}
+
+	dir := path.Join(gc.Path, ".git", UNTRACKED_DIR)
+	moved := []string{}
+
+	restore := func() {
+		for _, u := range moved {
+			fp := path.Join(gc.Path, u)
+
+			if err := os.MkdirAll(path.Dir(fp), 0o755); err != nil {
+				log.Println(fmt.Errorf("failed to restore untracked \"%v\": %w", u, err))
+			} else if err := os.Rename(path.Join(dir, u), fp); err != nil {
+				log.Println(fmt.Errorf("failed to restore untracked \"%v\": %w", u, err))
+			}
+		}
+
+		os.RemoveAll(dir)
+	}
+
+	for _, u := range untracked {
+		kept := path.Join(dir, u)
+		err := os.MkdirAll(path.Dir(kept), 0o755)
+
+		if err == nil {
+			err = os.Rename(path.Join(gc.Path, u), kept)
+		}
+
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set untracked \"%v\" aside: %w", u, err)
+		}
+
+		moved = append(moved, u)
+	}
+
+	return restore, nil
+}
+
+// overlap reports whether two paths are the same or one contains the other.
+func overlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// writeFile writes content at p in the worktree with the given tree entry mode, replacing the file there.
+func (gc *GitClient) writeFile(p string, content []byte, mode filemode.FileMode) error {
+	fp := path.Join(gc.Path, p)
+
+	if err := os.MkdirAll(path.Dir(fp), 0o755); err != nil {
+		return err
+	}
+
+	// removed first, so the new mode applies and a symlink is not followed
+	if err := os.Remove(fp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if mode == filemode.Symlink {
+		return os.Symlink(string(content), fp)
+	}
+
+	m, err := mode.ToOSFileMode()
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fp, content, m.Perm())
+}
+
+// mergeLocksAt merges the locks file as changed from base to local into its version at remote.
+func mergeLocksAt(base, local, remote *object.Commit) ([]byte, error) {
+	versions := make([][]byte, 3)
+
+	for i, c := range []*object.Commit{base, local, remote} {
+		b, err := fileContent(c, LOCKS_FILE)
+
+		if err != nil {
+			return nil, err
+		}
+
+		versions[i] = b
+	}
+
+	return mergeLocks(versions[0], versions[1], versions[2])
+}
+
+// fileContent returns the content of p at commit c, or nil if c has no such file.
+func fileContent(c *object.Commit, p string) ([]byte, error) {
+	f, err := c.File(p)
+
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	content, err := f.Contents()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(content), nil
+}
+
+// diffPaths returns the paths changed between two commits with their blob hash in to, or the zero hash if deleted.
+func diffPaths(from, to *object.Commit) (map[string]plumbing.Hash, error) {
+	ft, err := from.Tree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tt, err := to.Tree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(ft, tt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]plumbing.Hash, len(changes))
+
+	for _, ch := range changes {
+		if ch.To.Name != "" {
+			paths[ch.To.Name] = ch.To.TreeEntry.Hash
+		} else {
+			paths[ch.From.Name] = plumbing.ZeroHash
+		}
+	}
+
+	return paths, nil
+}
+
+// authorsSince maps every path changed by the commits after base up to head to the name of the newest author that changed it.
+func authorsSince(base, head *object.Commit) (map[string]string, error) {
+	authors := map[string]string{}
+
+	iter := object.NewCommitPreorderIter(head, nil, []plumbing.Hash{base.Hash})
+
+	err := iter.ForEach(func(c *object.Commit) error {
+		paths, err := changedPaths(c)
+
+		if err != nil {
+			return err
+		}
+
+		for _, p := range paths {
+			if _, ok := authors[p]; !ok {
+				authors[p] = c.Author.Name
+			}
+		}
+
+		return nil
+	})
+
+	return authors, err
+}
+
+// reportConflicts attaches conflicts to the pending operations that changed the conflicting paths.
+func (gc *GitClient) reportConflicts(conflicts []Conflict) {
+	gc.ops.each(func(id int64, op *Operation) bool {
+		found := false
+
+		for _, c := range conflicts {
+			if slices.Contains(op.paths, c.Path) {
+				op.Conflicts = append(op.Conflicts, c)
+				found = true
+			}
+		}
+
+		return found
+	})
+}
@@ -0,0 +1,242 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// DivergeStrategy decides how unpushed local commits are reconciled with new remote commits.
+type DivergeStrategy string
+
+const (
+	// DIVERGE_MERGE records a merge commit, saving the local version of paths changed on both sides as conflict copies.
+	DIVERGE_MERGE DivergeStrategy = "merge"
+	// DIVERGE_REBASE replays the unpushed local commits on top of the remote, keeping the history linear.
+	// It gives up when a path other than the locks file, which is merged entry by entry, was changed on both sides.
+	DIVERGE_REBASE DivergeStrategy = "rebase"
+)
+
+// ErrUnresolvedDivergence is returned when local and remote histories diverged and cannot be reconciled automatically.
+// The local history is left as it was and its commits stay unpushed until the divergence is resolved by hand.
+var ErrUnresolvedDivergence = errors.New("local and remote histories diverged and cannot be reconciled automatically")
+
+// ParseDivergeStrategy converts a configuration value into a DivergeStrategy.
+// An empty value defaults to DIVERGE_MERGE.
+func ParseDivergeStrategy(s string) (DivergeStrategy, error) {
+	switch DivergeStrategy(s) {
+	case "", DIVERGE_MERGE:
+		return DIVERGE_MERGE, nil
+	case DIVERGE_REBASE:
+		return DIVERGE_REBASE, nil
+	default:
+		return "", errors.New("unknown divergence strategy \"" + s + "\"")
+	}
+}
+
+// DivergeWith sets how the client reconciles its unpushed commits with diverged remote commits. It defaults to DIVERGE_MERGE.
+func (gc *GitClient) DivergeWith(s DivergeStrategy) {
+	gc.do(func() error {
+		gc.strategy = s
+		return nil
+	})
+}
+
+// rebase replays the commits between base and local, oldest first, on top of remote. Each replayed commit keeps
+// its message and author, and the operations that pointed at it are moved to its copy.
+// Nothing is replayed if local history holds merges or if a path other than the locks file was changed on both sides
+// to different content; both fail with ErrUnresolvedDivergence.
+func (gc *GitClient) rebase(w *git.Worktree, base, local, remote *object.Commit) error {
+	commits := []*object.Commit{}
+
+	for c := local; c.Hash != base.Hash; {
+		if c.NumParents() != 1 {
+			return fmt.Errorf("%w: unpushed commit %v is a merge", ErrUnresolvedDivergence, c.Hash.String()[:7])
+		}
+
+		commits = append(commits, c)
+
+		parent, err := c.Parent(0)
+
+		if err != nil {
+			return err
+		}
+
+		c = parent
+	}
+
+	slices.Reverse(commits)
+
+	localChanged, err := diffPaths(base, local)
+
+	if err != nil {
+		return err
+	}
+
+	remoteChanged, err := diffPaths(base, remote)
+
+	if err != nil {
+		return err
+	}
+
+	conflicts := []string{}
+
+	for p, h := range localChanged {
+		if rhash, ok := remoteChanged[p]; ok && rhash != h && p != LOCKS_FILE {
+			conflicts = append(conflicts, p)
+		}
+	}
+
+	slices.Sort(conflicts)
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%w: changed on both sides: %v", ErrUnresolvedDivergence, strings.Join(conflicts, " | "))
+	}
+
+	if err := w.Reset(&git.ResetOptions{Commit: remote.Hash, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to reset to remote: %w", err)
+	}
+
+	rewritten := map[string]string{}
+
+	for _, c := range commits {
+		h, err := gc.replay(w, c)
+
+		if err != nil {
+			// put the local history back so nothing is lost
+			if rerr := w.Reset(&git.ResetOptions{Commit: local.Hash, Mode: git.HardReset}); rerr != nil {
+				return fmt.Errorf("failed to replay %v: %w, and to restore local history: %w", c.Hash.String()[:7], err, rerr)
+			}
+
+			return fmt.Errorf("failed to replay %v: %w", c.Hash.String()[:7], err)
+		}
+
+		rewritten[c.Hash.String()] = h.String()
+	}
+
+	gc.ops.each(func(id int64, op *Operation) bool {
+		h, ok := rewritten[op.Hash]
+
+		if ok {
+			op.Hash = h
+		}
+
+		return ok
+	})
+
+	return nil
+}
+
+// replay applies the changes of c to the worktree and commits them with c's message and author.
+// Changes to the locks file are merged into the worktree's version instead of overwriting it.
+// A commit whose changes are already on the remote is skipped and the hash of HEAD returned.
+func (gc *GitClient) replay(w *git.Worktree, c *object.Commit) (plumbing.Hash, error) {
+	parent, err := c.Parent(0)
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	changed, err := diffPaths(parent, c)
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	paths := []string{}
+
+	for p, h := range changed {
+		if h.IsZero() {
+			err = os.Remove(path.Join(gc.Path, p))
+		} else {
+			err = gc.replayFile(c, parent, p)
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return plumbing.ZeroHash, fmt.Errorf("failed to replay \"%v\": %w", p, err)
+		}
+
+		paths = append(paths, p)
+	}
+
+	if err := gc.add(paths, true); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if status, err := w.Status(); err != nil {
+		return plumbing.ZeroHash, err
+	} else if status.IsClean() {
+		head, err := gc.repo.Head()
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return head.Hash(), nil
+	}
+
+	author := c.Author
+	return gc.commitSigned(w, c.Message, &git.CommitOptions{Author: &author, Committer: gc.identity()})
+}
+
+// replayFile writes the version of p in c to the worktree with the mode of its tree entry.
+func (gc *GitClient) replayFile(c, parent *object.Commit, p string) error {
+	f, err := c.File(p)
+
+	if err != nil {
+		return err
+	}
+
+	s, err := f.Contents()
+
+	if err != nil {
+		return err
+	}
+
+	content := []byte(s)
+
+	if p == LOCKS_FILE {
+		if content, err = gc.mergeReplayedLocks(parent, content); err != nil {
+			return err
+		}
+	}
+
+	return gc.writeFile(p, content, f.Mode)
+}
+
+// mergeReplayedLocks merges the locks file of a replayed commit, as changed from parent, into the worktree's version.
+func (gc *GitClient) mergeReplayedLocks(parent *object.Commit, local []byte) ([]byte, error) {
+	base, err := fileContent(parent, LOCKS_FILE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := os.ReadFile(path.Join(gc.Path, LOCKS_FILE))
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return mergeLocks(base, local, current)
+}
+
+// reportDivergence attaches the reason the divergence could not be resolved to the committed operations awaiting push.
+func (gc *GitClient) reportDivergence(err error) {
+	gc.ops.each(func(id int64, op *Operation) bool {
+		if op.Stage != "commit" {
+			return false
+		}
+
+		op.Data = err.Error()
+
+		return true
+	})
+}
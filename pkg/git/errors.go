@@ -0,0 +1,23 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStale is returned when a file changed since the version a write was based on.
+var ErrStale = errors.New("file changed since it was loaded")
+
+// StaleError reports the current blob hash of a file that changed under a write.
+type StaleError struct {
+	Path    string
+	Current string // Current is the blob hash of the file in the worktree.
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("failed to write \"%v\", current version is %v: %v", e.Path, e.Current, ErrStale)
+}
+
+func (e *StaleError) Unwrap() error {
+	return ErrStale
+}
@@ -5,122 +5,376 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 )
 
 // Storage is an interface that defines the methods for interacting with the Git storage.
 type Storage interface {
-	ReadDir(path string) ([]fs.FileInfo, error)
+	ReadDir(path string, all bool) ([]fs.FileInfo, error)
 	Remove(path string) error
 }
 
 // GitFileSystem represents the Git storage.
 type GitFileSystem struct {
-	Path      string     // Path is the root path of the Git storage.
-	Processor *GitClient // Processor is the Git processor associated with the storage.
+	Path      string       // Path is the root path of the Git storage.
+	Processor *GitClient   // Processor is the Git processor associated with the storage.
+	Hidden    []string     // Hidden holds drive-level gitignore-style patterns hidden from listings.
+	Policy    IgnorePolicy // Policy defines how mutations on ignored paths are handled.
 }
 
 // NewGitFileSystem creates a new instance of GitStorage.
-// It takes a pointer to a GitProcessor and returns a pointer to a GitStorage.
-func NewGitFileSystem(processor *GitClient) *GitFileSystem {
-	return &GitFileSystem{Path: path.Clean(processor.Path), Processor: processor}
+// It takes a pointer to a GitProcessor, the drive's hidden patterns and its ignore policy, and returns a pointer to a GitStorage.
+func NewGitFileSystem(processor *GitClient, hidden []string, policy IgnorePolicy) *GitFileSystem {
+	return &GitFileSystem{Path: path.Clean(processor.Path), Processor: processor, Hidden: hidden, Policy: policy}
 }
 
 // ReadDir reads the contents of a directory specified by the given path.
 // It returns a slice of fs.FileInfo representing the files and directories in the directory.
 // If the path is "/", it reads the root directory.
-// The function excludes the ".git" directory from the result.
-func (gfs *GitFileSystem) ReadDir(p string) ([]fs.FileInfo, error) {
+// The function always excludes the ".git" and DRIVE_DIR directories from the result and, unless all is set,
+// the entries matched by .gitignore or by the drive's hidden patterns.
+func (gfs *GitFileSystem) ReadDir(p string, all bool) ([]fs.FileInfo, error) {
 	if p == "/" {
 		p = ""
 	}
 
-	path := path.Join(gfs.Path, p)
-	dirs, err := os.ReadDir(path)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory \"%v\": %w", path, err)
+	if reserved(p) {
+		return nil, fmt.Errorf("failed to read directory \"%v\": %w", p, fs.ErrNotExist)
 	}
 
-	size := len(dirs)
+	dp := path.Join(gfs.Path, p)
+	dirs, err := os.ReadDir(dp)
 
-	if p == "" {
-		size -= 1
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory \"%v\": %w", dp, err)
 	}
 
-	var infos = make([]fs.FileInfo, size)
+	infos := make([]fs.FileInfo, 0, len(dirs))
 
-	i := 0
 	for _, dir := range dirs {
-		if dir.Name() == ".git" {
-			continue
-		}
-
-		infos[i], err = dir.Info()
+		info, err := dir.Info()
 
 		if err != nil {
 			return nil, err
 		}
 
-		i++
+		infos = append(infos, info)
 	}
 
-	return infos, nil
+	return gfs.visible(p, infos, all)
 }
 
-func (gfs *GitFileSystem) removeRecursively(p string) ([]string, error) {
-	info, err := os.Stat(path.Join(gfs.Path, p))
+// ReadDirAt reads the directory p as it was in revision rev, filtered like ReadDir.
+func (gfs *GitFileSystem) ReadDirAt(rev, p string, all bool) ([]fs.FileInfo, error) {
+	if reserved(p) {
+		return nil, fmt.Errorf("failed to read directory \"%v\" at %v: %w", p, rev, fs.ErrNotExist)
+	}
+
+	infos, err := gfs.Processor.ReadDirAt(rev, p)
 
 	if err != nil {
 		return nil, err
 	}
 
-	paths := []string{}
+	return gfs.visible(p, infos, all)
+}
 
-	if info.IsDir() {
+// visible filters the entries of directory p: ".git" and DRIVE_DIR are always left out and, unless all is set,
+// so are the entries matched by .gitignore or by the drive's hidden patterns.
+func (gfs *GitFileSystem) visible(p string, infos []fs.FileInfo, all bool) ([]fs.FileInfo, error) {
+	m, err := call(gfs.Processor, func() (gitignore.Matcher, error) { return gfs.Processor.ignoreMatcher(gfs.Hidden...) })
 
-		if dirs, err := os.ReadDir(path.Join(gfs.Path, p)); err == nil {
-			for _, dir := range dirs {
-				if dirPaths, err := gfs.removeRecursively(path.Join(p, dir.Name())); err == nil {
-					paths = append(paths, dirPaths...)
-				} else {
-					return nil, err
-				}
-			}
-		} else {
-			return nil, err
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore rules: %w", err)
+	}
+
+	p = strings.Trim(path.Join("/", p), "/")
+	visible := make([]fs.FileInfo, 0, len(infos))
+
+	for _, info := range infos {
+		if reserved(path.Join(p, info.Name())) {
+			continue
 		}
 
-	} else {
-		paths = append(paths, p)
+		if !all && m.Match(append(splitPath(p), info.Name()), info.IsDir()) {
+			continue
+		}
+
+		visible = append(visible, info)
 	}
 
-	if err := os.Remove(path.Join(gfs.Path, p)); err != nil {
-		return nil, err
+	return visible, nil
+}
+
+// VisibleFrom reports whether p is listed by ReadDir, without all, in every directory from root down to it.
+// Paths in the ".git" and DRIVE_DIR directories are never visible.
+func (gfs *GitFileSystem) VisibleFrom(root, p string, isDir bool) (bool, error) {
+	if reserved(p) {
+		return false, nil
+	}
+
+	m, err := call(gfs.Processor, func() (gitignore.Matcher, error) { return gfs.Processor.ignoreMatcher(gfs.Hidden...) })
+
+	if err != nil {
+		return false, fmt.Errorf("failed to read ignore rules: %w", err)
+	}
+
+	p = strings.Trim(path.Join("/", p), "/")
+
+	if p == "" {
+		return true, nil
+	}
+
+	parts := splitPath(p)
+	depth := 0
+
+	if r := strings.Trim(path.Join("/", root), "/"); r != "" {
+		depth = len(splitPath(r))
 	}
 
-	return paths, nil
+	for i := depth + 1; i <= len(parts); i++ {
+		if m.Match(parts[:i], i < len(parts) || isDir) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// files returns the files at p, or under it if it is a directory, relative to the repository root.
+func (gfs *GitFileSystem) files(p string) ([]string, error) {
+	files := []string{}
+
+	err := filepath.WalkDir(path.Join(gfs.Path, p), func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			rel, err := filepath.Rel(gfs.Path, fp)
+
+			if err != nil {
+				return err
+			}
+
+			files = append(files, filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+
+	return files, err
 }
 
 // Remove removes a file or directory from the Git storage.
 // It returns the commit operation ID and any error encountered.
-func (gfs *GitFileSystem) Remove(p string) (int64, error) {
-	gp := gfs.Processor
+// Ignored paths are rejected or force-staged according to the file system's Policy,
+// and paths locked by someone other than author fail with ErrLocked.
+// The commit is attributed to author, or to the server if nil.
+func (gfs *GitFileSystem) Remove(p string, author *Author) (int64, error) {
+	gc := gfs.Processor
+
+	return gc.change(func() (int64, error) {
+		if err := gfs.checkLock(p, author.email()); err != nil {
+			return -1, err
+		}
+
+		force, err := gfs.checkIgnored(p)
 
-	paths, err := gfs.removeRecursively(p)
+		if err != nil {
+			return -1, err
+		}
+
+		paths, err := gfs.files(p)
+
+		if err != nil {
+			return -1, err
+		}
+
+		cmd := gc.begin("rm: "+strings.Join(paths, " | "), paths, &CommitOptions{Force: force, Author: author})
+
+		if err := os.RemoveAll(path.Join(gfs.Path, p)); err != nil {
+			gc.abort(cmd, err)
+			return -1, err
+		}
+
+		gc.submit(cmd)
+
+		return cmd.id, nil
+	})
+}
+
+// checkIgnored applies the ignore policy to a mutation on p. Mutations on the root or on reserved paths always fail.
+// It returns whether the mutation must be force-staged, or ErrIgnoredPath if the policy rejects it.
+// It must run on the processing goroutine.
+func (gfs *GitFileSystem) checkIgnored(p string) (bool, error) {
+	if reserved(p) || path.Join("/", p) == "/" {
+		return false, fmt.Errorf("failed to change \"%v\": %w", p, fs.ErrPermission)
+	}
+
+	info, err := os.Stat(path.Join(gfs.Path, p))
+	isDir := err == nil && info.IsDir()
+
+	if !gfs.Processor.isIgnored(p, isDir) {
+		return false, nil
+	}
+
+	if gfs.Policy == IGNORE_POLICY_FORCE {
+		return true, nil
+	}
+
+	return false, fmt.Errorf("failed to change \"%v\": %w", p, ErrIgnoredPath)
+}
+
+// Open opens the file at p for reading.
+// It returns fs.ErrNotExist for directories and for paths inside the ".git" and DRIVE_DIR directories.
+func (gfs *GitFileSystem) Open(p string) (*os.File, fs.FileInfo, error) {
+	if reserved(p) {
+		return nil, nil, fmt.Errorf("failed to open \"%v\": %w", p, fs.ErrNotExist)
+	}
+
+	f, err := os.Open(path.Join(gfs.Path, path.Join("/", p)))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to open \"%v\": is a directory: %w", p, fs.ErrNotExist)
+	}
+
+	return f, info, nil
+}
+
+// OpenAt returns the content of the file p as it was in revision rev.
+// Like Open, it returns fs.ErrNotExist for paths inside the ".git" and DRIVE_DIR directories.
+func (gfs *GitFileSystem) OpenAt(rev, p string) ([]byte, fs.FileInfo, error) {
+	if reserved(p) {
+		return nil, nil, fmt.Errorf("failed to open \"%v\" at %v: %w", p, rev, fs.ErrNotExist)
+	}
+
+	return gfs.Processor.ReadFileAt(rev, p)
+}
+
+// Stat returns the fs.FileInfo of the file or directory at p.
+// Paths inside the ".git" directory are reported as not existing.
+func (gfs *GitFileSystem) Stat(p string) (fs.FileInfo, error) {
+	if inGitDir(p) {
+		return nil, fmt.Errorf("failed to stat \"%v\": %w", p, fs.ErrNotExist)
+	}
+
+	return os.Stat(path.Join(gfs.Path, path.Join("/", p)))
+}
+
+func inGitDir(p string) bool {
+	return inDir(p, ".git")
+}
+
+// reserved reports whether p belongs to git or to the drive's metadata and must not be mutated directly.
+func reserved(p string) bool {
+	return inDir(p, ".git") || inDir(p, DRIVE_DIR)
+}
+
+func inDir(p, dir string) bool {
+	p = path.Join("/", p)
+	return p == "/"+dir || strings.HasPrefix(p, "/"+dir+"/")
+}
+
+// BlobHash returns the git blob hash of the file at p as it is in the worktree.
+func (gfs *GitFileSystem) BlobHash(p string) (string, error) {
+	b, err := os.ReadFile(path.Join(gfs.Path, path.Join("/", p)))
+
+	if err != nil {
+		return "", err
+	}
+
+	return plumbing.ComputeHash(plumbing.BlobObject, b).String(), nil
+}
+
+// Write overwrites the existing file at p with content and commits it.
+// The write only happens if the file's current blob hash equals expected, otherwise it fails
+// with a *StaleError holding the current hash, so newer content is never clobbered,
+// and fails with ErrLocked if p is locked by someone other than author.
+// The checks, quota included, and the write run on the processing goroutine, so no pull or other change lands in between.
+// It returns the commit operation ID and the new blob hash. The commit is attributed to author, or to the server if nil.
+func (gfs *GitFileSystem) Write(p string, content []byte, expected string, author *Author, quota QuotaCheck) (int64, string, error) {
+	p = strings.TrimPrefix(path.Join("/", p), "/")
+
+	id, err := gfs.Processor.change(func() (int64, error) { return gfs.write(p, content, expected, author, quota) })
+
+	if err != nil {
+		return -1, "", err
+	}
+
+	return id, plumbing.ComputeHash(plumbing.BlobObject, content).String(), nil
+}
+
+func (gfs *GitFileSystem) write(p string, content []byte, expected string, author *Author, quota QuotaCheck) (int64, error) {
+	gc := gfs.Processor
+
+	if err := gfs.checkLock(p, author.email()); err != nil {
+		return -1, err
+	}
+
+	info, err := gfs.Stat(p)
+
+	if err != nil {
+		return -1, err
+	}
+
+	if info.IsDir() {
+		return -1, fmt.Errorf("failed to write \"%v\": is a directory: %w", p, fs.ErrNotExist)
+	}
+
+	force, err := gfs.checkIgnored(p)
 
 	if err != nil {
 		return -1, err
 	}
 
-	id, err := gp.Commit(
-		"rm: "+strings.Join(paths, " | "),
-		paths,
-	)
+	current, err := gfs.BlobHash(p)
 
 	if err != nil {
 		return -1, err
 	}
 
-	return id, nil
+	if current != expected {
+		return -1, &StaleError{p, current}
+	}
+
+	if err := gc.checkQuota(quota, Usage{Size: int64(len(content)) - info.Size()}); err != nil {
+		return -1, err
+	}
+
+	cmd := gc.begin("edit: "+p, []string{p}, &CommitOptions{Force: force, Author: author})
+	fp := path.Join(gfs.Path, p)
+	// outside the worktree, so neither the watcher nor a listing sees the half-written file
+	tmp := path.Join(gfs.Path, ".git", "git-drive-edit")
+
+	if err := os.WriteFile(tmp, content, info.Mode().Perm()); err != nil {
+		gc.abort(cmd, err)
+		return -1, err
+	}
+
+	if err := os.Rename(tmp, fp); err != nil {
+		os.Remove(tmp)
+		gc.abort(cmd, err)
+		return -1, err
+	}
+
+	gc.submit(cmd)
+
+	return cmd.id, nil
 }
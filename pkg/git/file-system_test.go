@@ -0,0 +1,246 @@
+package git_test
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/prxg22/git-drive/internal/testutil"
+	"github.com/prxg22/git-drive/pkg/git"
+)
+
+func blobHash(content string) string {
+	return plumbing.ComputeHash(plumbing.BlobObject, []byte(content)).String()
+}
+
+func TestFileSystemWrite(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+	local := testutil.LocalPath(t)
+
+	gc := newClient(t, url, "", local)
+	gc.PullEvery(time.Hour)
+	gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+
+	pushFrom(t, url, "a.txt", "remote")
+
+	if err := gc.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var stale *git.StaleError
+
+	if _, _, err := gfs.Write("a.txt", []byte("mine"), blobHash("a"), nil, nil); !errors.As(err, &stale) {
+		t.Fatalf("Expected a StaleError, got %v", err)
+	} else if stale.Current != blobHash("remote") {
+		t.Errorf("Expected the pulled hash %v, got %v", blobHash("remote"), stale.Current)
+	}
+
+	id, hash, err := gfs.Write("a.txt", []byte("mine"), blobHash("remote"), nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hash != blobHash("mine") {
+		t.Errorf("Expected hash %v, got %v", blobHash("mine"), hash)
+	}
+	if op := waitOperation(t, gc, id); op.Status != "success" {
+		t.Errorf("Expected success, got %+v", op)
+	}
+
+	entries, err := os.ReadDir(local)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, e := range entries {
+		if e.Name() != ".git" && e.Name() != "a.txt" {
+			t.Errorf("Expected no temporary file in the worktree, got %v", e.Name())
+		}
+	}
+
+	if b, _ := os.ReadFile(path.Join(local, "a.txt")); string(b) != "mine" {
+		t.Errorf("Expected \"mine\", got %q", b)
+	}
+}
+
+func TestFileSystemLocksDiverged(t *testing.T) {
+	testutil.WithIdentity(t)
+
+	for _, strategy := range []git.DivergeStrategy{git.DIVERGE_MERGE, git.DIVERGE_REBASE} {
+		url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "b.txt": "b", git.LOCKS_FILE: ""})
+
+		gc := newClient(t, url, "", testutil.LocalPath(t))
+		gc.PullEvery(time.Hour)
+		gc.DivergeWith(strategy)
+		gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+
+		if _, err := gfs.Lock("a.txt", "alice@example.com", "Alice"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		pushFrom(t, url, git.LOCKS_FILE, `{"path":"b.txt","owner":"bob@example.com","name":"Bob","since":"2024-01-01T00:00:00Z"}`+"\n")
+
+		if err := gc.Sync(); err != nil {
+			t.Fatalf("%v: unexpected error: %v", strategy, err)
+		}
+
+		locks, err := gfs.Locks()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(locks) != 2 || locks[0].Owner != "alice@example.com" || locks[1].Owner != "bob@example.com" {
+			t.Errorf("%v: expected the locks of both sides, got %+v", strategy, locks)
+		}
+
+		entries, _ := os.ReadDir(path.Join(gc.Path, git.DRIVE_DIR))
+		if len(entries) != 1 {
+			t.Errorf("%v: expected no conflict copy of the locks file, got %v entries", strategy, len(entries))
+		}
+	}
+}
+
+func TestFileSystemBatchRollback(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{"a.txt": "a"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+	gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+
+	// a socket cannot be staged, so committing the batch fails after its steps were applied
+	l, err := net.Listen("unix", path.Join(gc.Path, "s.sock"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	steps := []git.Step{{Op: "move", Path: "a.txt", To: "b.txt"}, {Op: "move", Path: "s.sock", To: "t.sock"}}
+
+	if _, err := gfs.Batch(steps, nil, nil); err == nil {
+		t.Fatalf("Expected the batch to fail")
+	}
+
+	if b, _ := os.ReadFile(path.Join(gc.Path, "a.txt")); string(b) != "a" {
+		t.Errorf("Expected a.txt to be restored, got %q", b)
+	}
+	for _, p := range []string{"b.txt", "t.sock"} {
+		if _, err := os.Lstat(path.Join(gc.Path, p)); !os.IsNotExist(err) {
+			t.Errorf("Expected %v to be rolled back, got %v", p, err)
+		}
+	}
+
+	repo, _ := gogit.PlainOpen(gc.Path)
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(idx.Entries) != 1 || idx.Entries[0].Name != "a.txt" {
+		t.Errorf("Expected the index to hold only a.txt, got %v", idx.Entries)
+	}
+}
+
+func names(infos []fs.FileInfo) []string {
+	n := []string{}
+	for _, i := range infos {
+		n = append(n, i.Name())
+	}
+	slices.Sort(n)
+	return n
+}
+
+func TestFileSystemIgnore(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{".gitignore": "*.log\n", "a.txt": "a", "b.log": "b", "secret.txt": "s", "dir/c.tmp": "c"})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+
+	if err := os.MkdirAll(path.Join(gc.Path, ".git", "info"), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(gc.Path, ".git", "info", "exclude"), []byte("*.tmp\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gfs := git.NewGitFileSystem(gc, []string{"secret.txt"}, git.IGNORE_POLICY_REJECT)
+
+	if infos, err := gfs.ReadDir("/", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if n := names(infos); !slices.Equal(n, []string{".gitignore", "a.txt", "dir"}) {
+		t.Errorf("Expected ignored and hidden files to be left out, got %v", n)
+	}
+	if infos, err := gfs.ReadDir("dir", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(infos) != 0 {
+		t.Errorf("Expected .git/info/exclude to apply, got %v", names(infos))
+	}
+	if infos, err := gfs.ReadDir("/", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if n := names(infos); !slices.Equal(n, []string{".gitignore", "a.txt", "b.log", "dir", "secret.txt"}) {
+		t.Errorf("Expected every file, got %v", n)
+	}
+
+	if _, _, err := gfs.Write("b.log", []byte("new"), blobHash("b"), nil, nil); !errors.Is(err, git.ErrIgnoredPath) {
+		t.Errorf("Expected ErrIgnoredPath, got %v", err)
+	}
+
+	forced := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_FORCE)
+
+	id, _, err := forced.Write("b.log", []byte("new"), blobHash("b"), nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if op := waitOperation(t, gc, id); op.Status != "success" {
+		t.Errorf("Expected the ignored path to be committed, got %+v", op)
+	}
+
+	if _, _, err := gfs.Write(".gitignore", []byte("*.log\na.txt\n"), blobHash("*.log\n"), nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if infos, err := gfs.ReadDir("/", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if n := names(infos); !slices.Equal(n, []string{".gitignore", "dir"}) {
+		t.Errorf("Expected the changed .gitignore to apply, got %v", n)
+	}
+}
+
+func TestFileSystemReadAt(t *testing.T) {
+	testutil.WithIdentity(t)
+	url := testutil.NewRemote(t, map[string]string{".gitignore": "*.log\n", "a.txt": "a", "b.log": "b", git.LOCKS_FILE: ""})
+
+	gc := newClient(t, url, "", testutil.LocalPath(t))
+	gc.PullEvery(time.Hour)
+	gfs := git.NewGitFileSystem(gc, nil, git.IGNORE_POLICY_REJECT)
+	rev := gc.Branch()
+
+	if infos, err := gfs.ReadDirAt(rev, "/", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if n := names(infos); !slices.Equal(n, []string{".gitignore", "a.txt"}) {
+		t.Errorf("Expected ignored files and the drive's metadata to be left out, got %v", n)
+	}
+	if infos, err := gfs.ReadDirAt(rev, "/", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if n := names(infos); !slices.Equal(n, []string{".gitignore", "a.txt", "b.log"}) {
+		t.Errorf("Expected every file but the drive's metadata, got %v", n)
+	}
+
+	if _, err := gfs.ReadDirAt(rev, git.DRIVE_DIR, true); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if _, _, err := gfs.OpenAt(rev, git.LOCKS_FILE); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	if _, _, err := gfs.Open(git.LOCKS_FILE); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+
+	if b, _, err := gfs.OpenAt(rev, "a.txt"); err != nil || string(b) != "a" {
+		t.Errorf("Expected \"a\", got %q (%v)", b, err)
+	}
+}
@@ -0,0 +1,171 @@
+package git
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// CHANGES_MAX_DEPTH is the number of commits ChangesBy walks back from HEAD at most,
+// so a user with few changes does not make it walk the whole history.
+const CHANGES_MAX_DEPTH = 1000
+
+// FileChange records a path added or modified by a commit.
+type FileChange struct {
+	Path string    // Path of the file relative to the repository root.
+	Hash string    // Hash of the commit.
+	When time.Time // When is the commit's author date.
+}
+
+// HistoryEntry is a commit as listed by History.
+type HistoryEntry struct {
+	Hash      string       `json:"hash"`
+	Message   string       `json:"message"`
+	Author    string       `json:"author"`
+	Email     string       `json:"email"`
+	When      time.Time    `json:"when"`
+	Signature Verification `json:"signature"`
+}
+
+// History walks the history from HEAD and returns up to max commits that changed p, or any path if p is the root,
+// newest first, with the verification of their signature against the server's signing key.
+func (gc *GitClient) History(p string, max int) ([]HistoryEntry, error) {
+	return call(gc, func() ([]HistoryEntry, error) { return gc.history(p, max) })
+}
+
+func (gc *GitClient) history(p string, max int) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	opts := &git.LogOptions{}
+
+	if p = strings.Trim(path.Clean("/"+p), "/"); p != "" {
+		opts.PathFilter = func(f string) bool { return f == p || strings.HasPrefix(f, p+"/") }
+	}
+
+	iter, err := gc.repo.Log(opts)
+
+	if err == plumbing.ErrReferenceNotFound {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = iter.ForEach(func(c *object.Commit) error {
+		if len(entries) >= max {
+			return storer.ErrStop
+		}
+
+		entries = append(entries, HistoryEntry{
+			Hash:      c.Hash.String(),
+			Message:   strings.TrimSpace(c.Message),
+			Author:    c.Author.Name,
+			Email:     c.Author.Email,
+			When:      c.Author.When,
+			Signature: gc.verify(c),
+		})
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// ChangesBy walks the last CHANGES_MAX_DEPTH commits from HEAD and returns up to max paths added or modified
+// by commits authored by email, newest first.
+func (gc *GitClient) ChangesBy(email string, max int) ([]FileChange, error) {
+	return call(gc, func() ([]FileChange, error) { return gc.changesBy(email, max) })
+}
+
+func (gc *GitClient) changesBy(email string, max int) ([]FileChange, error) {
+	changes := []FileChange{}
+	walked := 0
+
+	iter, err := gc.repo.Log(&git.LogOptions{})
+
+	if err == plumbing.ErrReferenceNotFound {
+		return changes, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = iter.ForEach(func(c *object.Commit) error {
+		if len(changes) >= max || walked >= CHANGES_MAX_DEPTH {
+			return storer.ErrStop
+		}
+
+		walked++
+
+		if c.Author.Email != email {
+			return nil
+		}
+
+		paths, err := changedPaths(c)
+
+		if err != nil {
+			return err
+		}
+
+		for _, p := range paths {
+			changes = append(changes, FileChange{p, c.Hash.String(), c.Author.When})
+		}
+
+		return nil
+	})
+
+	if len(changes) > max {
+		changes = changes[:max]
+	}
+
+	return changes, err
+}
+
+// changedPaths returns the paths added or modified by a commit compared to its first parent.
+// Every file of a root commit counts as added.
+func changedPaths(c *object.Commit) ([]string, error) {
+	tree, err := c.Tree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+
+	if c.NumParents() == 0 {
+		err = tree.Files().ForEach(func(f *object.File) error {
+			paths = append(paths, f.Name)
+			return nil
+		})
+
+		return paths, err
+	}
+
+	parent, err := c.Parent(0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ptree, err := parent.Tree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(ptree, tree)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ch := range changes {
+		if ch.To.Name != "" {
+			paths = append(paths, ch.To.Name)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var ErrHostKey = errors.New("ssh host key verification failed")
+
+// HostKeyConfig describes how the remote's SSH host key is verified.
+// Every configured check must pass. With nothing configured, the user's and the system's known_hosts files are used.
+type HostKeyConfig struct {
+	KnownHosts   string   // KnownHosts is the path of a known_hosts file.
+	Fingerprints []string // Fingerprints pins SHA256 key fingerprints, as printed by `ssh-keygen -lf`.
+	Insecure     bool     // Insecure accepts any host key. It cannot be combined with the other checks.
+}
+
+// HostKeyCallback builds the callback verifying host keys according to the configuration.
+// It fails at startup if the configuration is inconsistent or the known_hosts file cannot be read.
+func (c HostKeyConfig) HostKeyCallback() (gossh.HostKeyCallback, error) {
+	fingerprints := []string{}
+
+	for _, f := range c.Fingerprints {
+		if f = strings.TrimSpace(f); f != "" {
+			if !strings.HasPrefix(f, "SHA256:") {
+				f = "SHA256:" + f
+			}
+			fingerprints = append(fingerprints, f)
+		}
+	}
+
+	if c.Insecure {
+		if c.KnownHosts != "" || len(fingerprints) > 0 {
+			return nil, fmt.Errorf("insecure host key mode cannot be combined with known hosts or fingerprints")
+		}
+
+		return gossh.InsecureIgnoreHostKey(), nil
+	}
+
+	var files []string
+
+	if c.KnownHosts != "" {
+		files = append(files, c.KnownHosts)
+	}
+
+	var known gossh.HostKeyCallback
+
+	if c.KnownHosts != "" || len(fingerprints) == 0 {
+		var err error
+
+		if known, err = ssh.NewKnownHostsCallback(files...); err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		fingerprint := gossh.FingerprintSHA256(key)
+
+		if len(fingerprints) > 0 && !slices.Contains(fingerprints, fingerprint) {
+			return fmt.Errorf("%v presented unpinned key %v: %w", hostname, fingerprint, ErrHostKey)
+		}
+
+		if known != nil {
+			if err := known(hostname, remote, key); err != nil {
+				return fmt.Errorf("%v presented key %v: %v: %w", hostname, fingerprint, err, ErrHostKey)
+			}
+		}
+
+		return nil
+	}, nil
+}
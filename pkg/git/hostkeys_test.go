@@ -0,0 +1,83 @@
+package git_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/prxg22/git-drive/pkg/git"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newHostKey(t *testing.T) gossh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return key
+}
+
+func TestHostKeyFingerprints(t *testing.T) {
+	pinned, other := newHostKey(t), newHostKey(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+	cb, err := git.HostKeyConfig{Fingerprints: []string{gossh.FingerprintSHA256(pinned)}}.HostKeyCallback()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := cb("git.example.com:22", addr, pinned); err != nil {
+		t.Errorf("Expected pinned key to be accepted, got %v", err)
+	}
+
+	if err := cb("git.example.com:22", addr, other); !errors.Is(err, git.ErrHostKey) {
+		t.Errorf("Expected unpinned key to be rejected, got %v", err)
+	}
+}
+
+func TestHostKeyKnownHosts(t *testing.T) {
+	known, other := newHostKey(t), newHostKey(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+	file := path.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{"git.example.com"}, known) + "\n"
+	if err := os.WriteFile(file, []byte(line), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cb, err := git.HostKeyConfig{KnownHosts: file}.HostKeyCallback()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := cb("git.example.com:22", addr, known); err != nil {
+		t.Errorf("Expected known key to be accepted, got %v", err)
+	}
+
+	if err := cb("git.example.com:22", addr, other); !errors.Is(err, git.ErrHostKey) {
+		t.Errorf("Expected unknown key to be rejected, got %v", err)
+	}
+}
+
+func TestHostKeyConfigErrors(t *testing.T) {
+	if _, err := (git.HostKeyConfig{KnownHosts: path.Join(t.TempDir(), "missing")}).HostKeyCallback(); err == nil {
+		t.Errorf("Expected missing known_hosts file to fail")
+	}
+
+	if _, err := (git.HostKeyConfig{Insecure: true, Fingerprints: []string{"SHA256:abc"}}).HostKeyCallback(); err == nil {
+		t.Errorf("Expected insecure mode with fingerprints to fail")
+	}
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// IgnorePolicy defines how mutations on paths matched by .gitignore are handled.
+type IgnorePolicy string
+
+const (
+	// IGNORE_POLICY_REJECT fails any mutation whose target path is ignored.
+	IGNORE_POLICY_REJECT IgnorePolicy = "reject"
+	// IGNORE_POLICY_FORCE stages ignored paths anyway, like `git add -f`.
+	IGNORE_POLICY_FORCE IgnorePolicy = "force"
+)
+
+// ErrIgnoredPath is returned when a mutation targets a path matched by the ignore rules.
+var ErrIgnoredPath = errors.New("path is ignored")
+
+// ParseIgnorePolicy converts a configuration value into an IgnorePolicy.
+// An empty value defaults to IGNORE_POLICY_REJECT.
+func ParseIgnorePolicy(s string) (IgnorePolicy, error) {
+	switch IgnorePolicy(s) {
+	case "", IGNORE_POLICY_REJECT:
+		return IGNORE_POLICY_REJECT, nil
+	case IGNORE_POLICY_FORCE:
+		return IGNORE_POLICY_FORCE, nil
+	default:
+		return "", errors.New("unknown ignore policy \"" + s + "\"")
+	}
+}
+
+type ignoreCache struct {
+	head     plumbing.Hash
+	patterns []gitignore.Pattern
+}
+
+// ignoreMatcher, which must run on the processing goroutine, builds a matcher from .git/info/exclude, every .gitignore
+// in the worktree and the extra patterns given, each taking precedence over the previous ones.
+// The patterns read from the worktree are cached until HEAD moves, or while an operation not committed yet
+// changes a .gitignore, as changes outside the drive reach HEAD through the watcher.
+func (gc *GitClient) ignoreMatcher(extra ...string) (gitignore.Matcher, error) {
+	patterns, err := gc.ignorePatterns()
+
+	if err != nil {
+		return nil, err
+	}
+
+	patterns = slices.Clone(patterns)
+
+	for _, p := range extra {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, gitignore.ParsePattern(p, nil))
+		}
+	}
+
+	return gitignore.NewMatcher(patterns), nil
+}
+
+func (gc *GitClient) ignorePatterns() ([]gitignore.Pattern, error) {
+	var head plumbing.Hash
+
+	if ref, err := gc.repo.Head(); err == nil {
+		head = ref.Hash()
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	pending := slices.ContainsFunc(gc.ops.pendingPaths(), func(p string) bool { return path.Base(p) == ".gitignore" })
+
+	if c := gc.ignores; c != nil && c.head == head && !pending {
+		return c.patterns, nil
+	}
+
+	w, err := gc.repo.Worktree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := gitignore.ReadPatterns(w.Filesystem, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !pending {
+		gc.ignores = &ignoreCache{head, patterns}
+	}
+
+	return patterns, nil
+}
+
+// IsIgnored reports whether the path, relative to the repository root, is matched by the ignore rules.
+func (gc *GitClient) IsIgnored(p string, isDir bool) bool {
+	ignored, _ := call(gc, func() (bool, error) { return gc.isIgnored(p, isDir), nil })
+
+	return ignored
+}
+
+func (gc *GitClient) isIgnored(p string, isDir bool) bool {
+	m, err := gc.ignoreMatcher()
+
+	if err != nil {
+		return false
+	}
+
+	return m.Match(splitPath(p), isDir)
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
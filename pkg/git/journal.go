@@ -0,0 +1,269 @@
+package git
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// JOURNAL_FILE is the path, relative to the repository's .git directory, of the operation journal.
+const JOURNAL_FILE = "git-drive-journal"
+
+// JOURNAL_MAX_DONE is the number of finished operations kept, so their final state can still be queried.
+const JOURNAL_MAX_DONE = 1000
+
+// JOURNAL_COMPACT_EVERY is the number of records appended before the journal is rewritten with the latest ones only.
+const JOURNAL_COMPACT_EVERY = 1000
+
+// journalEntry is a snapshot of an operation and of the command that started it.
+type journalEntry struct {
+	Id        int64      `json:"id"`
+	Message   string     `json:"message"`
+	Paths     []string   `json:"paths"`
+	Force     bool       `json:"force,omitempty"`
+	Author    *Author    `json:"author,omitempty"`
+	Stage     string     `json:"stage"`
+	Status    string     `json:"status"`
+	Progress  uint32     `json:"progress"`
+	Data      string     `json:"data,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	Done      bool       `json:"done,omitempty"`
+}
+
+// journal appends operation snapshots, one JSON object per line, to a file in the .git directory.
+// The last snapshot of an operation wins when the journal is read back.
+// It is not safe for concurrent use; the registry serializes its writes.
+type journal struct {
+	path    string
+	f       *os.File
+	records int
+}
+
+func newEntry(cmd *command, op *Operation, done bool) journalEntry {
+	return journalEntry{
+		Id:        cmd.id,
+		Message:   cmd.message,
+		Paths:     cmd.paths,
+		Force:     cmd.force,
+		Author:    cmd.author,
+		Stage:     op.Stage,
+		Status:    op.Status,
+		Progress:  op.Progress,
+		Data:      op.Data,
+		Hash:      op.Hash,
+		Conflicts: op.Conflicts,
+		Done:      done,
+	}
+}
+
+func (e journalEntry) command() *command {
+	return &command{id: e.Id, message: e.Message, paths: e.Paths, force: e.Force, author: e.Author}
+}
+
+func (e journalEntry) operation() Operation {
+	return Operation{Stage: e.Stage, Status: e.Status, Progress: e.Progress, Data: e.Data, Hash: e.Hash, Conflicts: e.Conflicts, paths: e.Paths}
+}
+
+// openJournal reads the journal of the repository at repoPath and compacts it.
+// It returns the last snapshot of every operation, ordered by id.
+func openJournal(repoPath string) (*journal, []journalEntry, error) {
+	j := &journal{path: path.Join(repoPath, ".git", JOURNAL_FILE)}
+	latest := map[int64]journalEntry{}
+
+	f, err := os.Open(j.path)
+
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16<<20)
+
+		for scanner.Scan() {
+			var e journalEntry
+
+			// a torn last line, left by a crash mid-write, is skipped
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				log.Println(fmt.Errorf("skipping journal record: %w", err))
+				continue
+			}
+
+			latest[e.Id] = e
+		}
+
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read journal \"%v\": %w", j.path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to open journal \"%v\": %w", j.path, err)
+	}
+
+	entries := make([]journalEntry, 0, len(latest))
+
+	for _, e := range latest {
+		entries = append(entries, e)
+	}
+
+	slices.SortFunc(entries, func(a, b journalEntry) int { return cmp.Compare(a.Id, b.Id) })
+	entries = pruneDone(entries)
+
+	if err := j.compact(entries); err != nil {
+		return nil, nil, err
+	}
+
+	return j, entries, nil
+}
+
+// pruneDone drops the oldest finished entries beyond JOURNAL_MAX_DONE. entries must be ordered by id.
+func pruneDone(entries []journalEntry) []journalEntry {
+	done := 0
+
+	for _, e := range entries {
+		if e.Done {
+			done++
+		}
+	}
+
+	return slices.DeleteFunc(entries, func(e journalEntry) bool {
+		if e.Done && done > JOURNAL_MAX_DONE {
+			done--
+			return true
+		}
+		return false
+	})
+}
+
+// append writes one snapshot to the journal.
+func (j *journal) append(e journalEntry) error {
+	b, err := json.Marshal(e)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal \"%v\": %w", j.path, err)
+	}
+
+	j.records++
+
+	return nil
+}
+
+// compact atomically replaces the journal with entries and reopens it for appending.
+func (j *journal) compact(entries []journalEntry) error {
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+
+	if err != nil {
+		return fmt.Errorf("failed to compact journal \"%v\": %w", j.path, err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to compact journal \"%v\": %w", j.path, err)
+	}
+
+	if j.f != nil {
+		j.f.Close()
+	}
+
+	if j.f, err = os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+		return fmt.Errorf("failed to open journal \"%v\": %w", j.path, err)
+	}
+
+	j.records = len(entries)
+
+	return nil
+}
+
+// resume queues the committed operations of a previous run for pushing and returns the commands
+// of the operations that were not committed yet, to be processed again. It runs before the processing goroutine starts.
+func (gc *GitClient) resume(unfinished []journalEntry) []*command {
+	cmds := []*command{}
+	committed := map[string][]*command{}
+	hashes := []string{}
+
+	for _, e := range unfinished {
+		cmd := e.command()
+
+		switch e.Stage {
+		case "commit", "push":
+			if _, ok := committed[e.Hash]; !ok {
+				hashes = append(hashes, e.Hash)
+			}
+			committed[e.Hash] = append(committed[e.Hash], cmd)
+		default:
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	for _, h := range hashes {
+		if gc.queue.IsFull() {
+			if err := gc.pushCmds(context.Background()); err != nil {
+				log.Println(err)
+			}
+		}
+
+		gc.queue.Enqueue(committed[h])
+	}
+
+	if len(unfinished) > 0 {
+		log.Printf("resuming %d unfinished operations\n", len(unfinished))
+	}
+
+	return cmds
+}
+
+// repush pushes the queued commands, or else the working branch if it is ahead of the remote,
+// so commits left unpushed by a previous run reach the remote.
+func (gc *GitClient) repush() error {
+	if gc.queue.Length() > 0 {
+		return gc.pushCmds(context.Background())
+	}
+
+	head, err := gc.repo.Head()
+
+	if err != nil || !head.Name().IsBranch() {
+		return nil
+	}
+
+	tracking, err := gc.repo.Reference(plumbing.NewRemoteReferenceName(gc.remote, head.Name().Short()), true)
+
+	if err == nil && tracking.Hash() == head.Hash() {
+		return nil
+	}
+
+	if err := gc.push(context.Background()); err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrClosed is returned by the client's methods once Close was called.
+var ErrClosed = errors.New("git client is closed")
+
+// stop asks the processing goroutine to flush the pending work within ctx and return.
+type stop struct {
+	ctx  context.Context
+	done chan error
+}
+
+// Close stops the client gracefully: Commit fails with ErrClosed from now on, the commands already sent
+// are committed right away, even those waiting for their coalescing window, and everything committed is pushed.
+// The push gives up once ctx is done; unpushed commits stay in the journal and are pushed on the next start.
+// The processing goroutine exits afterwards, so the other methods fail with ErrClosed.
+func (gc *GitClient) Close(ctx context.Context) error {
+	gc.closing.Lock()
+	closed := gc.closed
+	gc.closed = true
+	gc.closing.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	done := make(chan error, 1)
+
+	select {
+	case gc.stops <- stop{ctx, done}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown commits the commands left in the channel and in the coalescing windows, then pushes.
+func (gc *GitClient) shutdown(ctx context.Context) error {
+	for drained := false; !drained; {
+		select {
+		case cmd := <-gc.cmds:
+			gc.coalesce.add(cmd)
+		default:
+			drained = true
+		}
+	}
+
+	for _, cmds := range gc.coalesce.flush(time.Now(), true) {
+		if err := gc.processCmds(cmds); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := gc.pushCmds(ctx); err != nil {
+		return fmt.Errorf("failed to push before closing: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DRIVE_DIR is the directory, committed with the content, in which the drive keeps its shared metadata.
+const DRIVE_DIR = ".gitdrive"
+
+// LOCKS_FILE is the path of the committed file holding the advisory locks, one JSON object per line.
+const LOCKS_FILE = DRIVE_DIR + "/locks"
+
+var ErrLocked = errors.New("path is locked")
+var ErrNotLocked = errors.New("path is not locked")
+
+// Lock is an advisory lock on a path, held by a user until released.
+type Lock struct {
+	Path  string    `json:"path"`
+	Owner string    `json:"owner"` // Owner is the email of the user holding the lock.
+	Name  string    `json:"name"`
+	Since time.Time `json:"since"`
+}
+
+// Locks reads the locks file from the worktree, so it reflects both local locks and those pulled from the remote.
+func (gfs *GitFileSystem) Locks() ([]Lock, error) {
+	b, err := os.ReadFile(path.Join(gfs.Path, LOCKS_FILE))
+
+	if os.IsNotExist(err) {
+		return []Lock{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read locks: %w", err)
+	}
+
+	return parseLocks(b)
+}
+
+func parseLocks(b []byte) ([]Lock, error) {
+	locks := []Lock{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			var l Lock
+
+			if err := json.Unmarshal([]byte(line), &l); err != nil {
+				return nil, fmt.Errorf("failed to parse lock \"%v\": %w", line, err)
+			}
+
+			locks = append(locks, l)
+		}
+	}
+
+	return locks, scanner.Err()
+}
+
+// checkLock fails with ErrLocked if p, or a path under it, is locked by someone other than owner.
+// It must run on the processing goroutine, in the same call as the change it guards, so no lock is taken in between.
+func (gfs *GitFileSystem) checkLock(p, owner string) error {
+	locks, err := gfs.Locks()
+
+	if err != nil {
+		return err
+	}
+
+	p = strings.Trim(path.Join("/", p), "/")
+
+	for _, l := range locks {
+		if l.Owner != owner && (p == "" || l.Path == p || strings.HasPrefix(l.Path, p+"/")) {
+			return fmt.Errorf("\"%v\" is locked by %v: %w", l.Path, l.Owner, ErrLocked)
+		}
+	}
+
+	return nil
+}
+
+// Lock locks the existing path p for owner and commits the locks file.
+// Locking a path already held by owner is a no-op.
+func (gfs *GitFileSystem) Lock(p, owner, name string) (*Lock, error) {
+	var l *Lock
+
+	_, err := gfs.Processor.change(func() (id int64, err error) {
+		l, id, err = gfs.lock(p, owner, name)
+		return id, err
+	})
+
+	return l, err
+}
+
+func (gfs *GitFileSystem) lock(p, owner, name string) (*Lock, int64, error) {
+	p = strings.Trim(path.Join("/", p), "/")
+
+	if _, err := gfs.Stat(p); err != nil {
+		return nil, -1, err
+	}
+
+	locks, err := gfs.Locks()
+
+	if err != nil {
+		return nil, -1, err
+	}
+
+	for _, l := range locks {
+		if l.Path == p && l.Owner == owner {
+			return &l, -1, nil
+		} else if l.Path == p {
+			return nil, -1, fmt.Errorf("\"%v\" is locked by %v: %w", l.Path, l.Owner, ErrLocked)
+		}
+	}
+
+	l := Lock{p, owner, name, time.Now().UTC()}
+	id, err := gfs.writeLocks(append(locks, l), "lock: "+p, &Author{name, owner})
+
+	if err != nil {
+		return nil, -1, err
+	}
+
+	return &l, id, nil
+}
+
+// Unlock releases the lock owner holds on p and commits the locks file as owner, named name.
+func (gfs *GitFileSystem) Unlock(p, owner, name string) error {
+	_, err := gfs.Processor.change(func() (int64, error) { return gfs.unlock(p, owner, name) })
+
+	return err
+}
+
+func (gfs *GitFileSystem) unlock(p, owner, name string) (int64, error) {
+	p = strings.Trim(path.Join("/", p), "/")
+	locks, err := gfs.Locks()
+
+	if err != nil {
+		return -1, err
+	}
+
+	i := slices.IndexFunc(locks, func(l Lock) bool { return l.Path == p })
+
+	if i < 0 {
+		return -1, fmt.Errorf("\"%v\": %w", p, ErrNotLocked)
+	}
+
+	if locks[i].Owner != owner {
+		return -1, fmt.Errorf("\"%v\" is locked by %v: %w", p, locks[i].Owner, ErrLocked)
+	}
+
+	return gfs.writeLocks(slices.Delete(locks, i, i+1), "unlock: "+p, &Author{name, owner})
+}
+
+// writeLocks writes the locks file and commits it. It must run on the processing goroutine.
+func (gfs *GitFileSystem) writeLocks(locks []Lock, message string, author *Author) (int64, error) {
+	gc := gfs.Processor
+	b, err := encodeLocks(locks)
+
+	if err != nil {
+		return -1, err
+	}
+
+	cmd := gc.begin(message, []string{LOCKS_FILE}, &CommitOptions{Force: true, Author: author})
+	fp := path.Join(gfs.Path, LOCKS_FILE)
+
+	if err := os.MkdirAll(path.Dir(fp), 0o755); err != nil {
+		gc.abort(cmd, err)
+		return -1, err
+	}
+
+	if err := os.WriteFile(fp, b, 0o644); err != nil {
+		gc.abort(cmd, err)
+		return -1, fmt.Errorf("failed to write locks: %w", err)
+	}
+
+	gc.submit(cmd)
+
+	return cmd.id, nil
+}
+
+func (l Lock) same(o Lock) bool {
+	return l.Path == o.Path && l.Owner == o.Owner && l.Since.Equal(o.Since)
+}
+
+// encodeLocks serializes locks as the locks file, sorted by path.
+func encodeLocks(locks []Lock) ([]byte, error) {
+	slices.SortFunc(locks, func(a, b Lock) int { return strings.Compare(a.Path, b.Path) })
+
+	var buf bytes.Buffer
+
+	for _, l := range locks {
+		line, err := json.Marshal(l)
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// mergeLocks merges the locks file changed from base to local into the remote's version, entry by entry:
+// locks taken locally are added and locks released locally are removed. A path locked differently on both sides
+// keeps the remote's lock, which reached the remote first. Missing files hold no lock.
+func mergeLocks(base, local, remote []byte) ([]byte, error) {
+	parsed := make([]map[string]Lock, 3)
+
+	for i, b := range [][]byte{base, local, remote} {
+		locks, err := parseLocks(b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parsed[i] = make(map[string]Lock, len(locks))
+
+		for _, l := range locks {
+			parsed[i][l.Path] = l
+		}
+	}
+
+	before, after, merged := parsed[0], parsed[1], parsed[2]
+
+	for p, l := range after {
+		if b, ok := before[p]; ok && b.same(l) {
+			continue
+		}
+
+		if r, ok := merged[p]; ok && !r.same(l) && !r.same(before[p]) {
+			log.Printf("\"%v\" was locked by %v on both sides, keeping the lock of %v\n", p, l.Owner, r.Owner)
+			continue
+		}
+
+		merged[p] = l
+	}
+
+	for p, b := range before {
+		if _, kept := after[p]; !kept && merged[p].same(b) {
+			delete(merged, p)
+		}
+	}
+
+	locks := make([]Lock, 0, len(merged))
+
+	for _, l := range merged {
+		locks = append(locks, l)
+	}
+
+	return encodeLocks(locks)
+}
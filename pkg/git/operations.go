@@ -0,0 +1,296 @@
+package git
+
+import (
+	"cmp"
+	"log"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Operation struct {
+	Stage     string
+	Status    string
+	Progress  uint32
+	Data      string
+	Hash      string     // Hash of the commit holding the operation's changes, shared by the operations coalesced into it.
+	Conflicts []Conflict // Conflicts found while merging diverged remote changes into the operation's paths.
+	paths     []string
+}
+
+// registry tracks the state of the operations and broadcasts every change to their listeners.
+// Changes are recorded in the journal, so unfinished operations can be resumed and finished ones
+// queried after a restart. It is safe for concurrent use.
+type registry struct {
+	mu      sync.Mutex
+	last    int64
+	ops     map[int64]*tracked
+	done    map[int64]journalEntry // final state of the last JOURNAL_MAX_DONE finished operations
+	journal *journal               // nil keeps the operations in memory only
+}
+
+type tracked struct {
+	cmd       *command
+	op        Operation
+	listeners []chan *Operation
+}
+
+func newRegistry() *registry {
+	return &registry{ops: make(map[int64]*tracked), done: make(map[int64]journalEntry)}
+}
+
+// openRegistry restores the operations journaled in the repository at repoPath.
+// It returns the commands of the unfinished operations, ordered by id.
+func openRegistry(repoPath string) (*registry, []journalEntry, error) {
+	j, entries, err := openJournal(repoPath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := newRegistry()
+	r.journal = j
+	unfinished := []journalEntry{}
+
+	for _, e := range entries {
+		r.last = max(r.last, e.Id)
+
+		if e.Done {
+			r.done[e.Id] = e
+		} else {
+			r.ops[e.Id] = &tracked{cmd: e.command(), op: e.operation()}
+			unfinished = append(unfinished, e)
+		}
+	}
+
+	return r, unfinished, nil
+}
+
+// create registers a pending operation for cmd and sets its id.
+// IDs are the creation time in milliseconds, bumped to stay unique.
+func (r *registry) create(cmd *command) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd.id = max(time.Now().UnixMilli(), r.last+1)
+	r.last = cmd.id
+	t := &tracked{cmd: cmd, op: Operation{Stage: "pending", paths: cmd.paths}}
+	r.ops[cmd.id] = t
+	r.record(t, false)
+
+	return cmd.id
+}
+
+// update applies f to the operation and broadcasts the result. It reports false if the operation is unknown.
+func (r *registry) update(id int64, f func(op *Operation)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.ops[id]
+
+	if ok {
+		f(&t.op)
+		t.broadcast()
+		r.record(t, false)
+	}
+
+	return ok
+}
+
+// each calls f on every operation, broadcasting those for which it returns true.
+func (r *registry) each(f func(id int64, op *Operation) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, t := range r.ops {
+		if f(id, &t.op) {
+			t.broadcast()
+			r.record(t, false)
+		}
+	}
+}
+
+// get returns the command and the state of an unfinished operation.
+func (r *registry) get(id int64) (*command, Operation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.ops[id]
+
+	if !ok {
+		return nil, Operation{}, false
+	}
+
+	return t.cmd, *t.op.copy(), true
+}
+
+// final returns the state a finished operation ended in, if it is still kept.
+func (r *registry) final(id int64) (Operation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.done[id]
+
+	return e.operation(), ok
+}
+
+// listen returns a channel receiving the operation's current state and then every change, closed once it finishes.
+// A finished operation sends its final state, and an unknown one none, before the channel is closed.
+func (r *registry) listen(id int64) chan *Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := make(chan *Operation, QUEUE_MAX_SIZE)
+	t, ok := r.ops[id]
+
+	if !ok {
+		if e, ok := r.done[id]; ok {
+			op := e.operation()
+			c <- op.copy()
+		}
+
+		close(c)
+		return c
+	}
+
+	c <- t.op.copy()
+	t.listeners = append(t.listeners, c)
+
+	return c
+}
+
+// finish closes the operation's listeners and keeps its final state.
+func (r *registry) finish(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.ops[id]; ok {
+		for _, c := range t.listeners {
+			close(c)
+		}
+
+		delete(r.ops, id)
+		r.done[id] = newEntry(t.cmd, &t.op, true)
+		r.record(t, true)
+
+		if len(r.done) > JOURNAL_MAX_DONE {
+			delete(r.done, slices.Min(mapKeys(r.done)))
+		}
+	}
+}
+
+// pendingPaths returns the paths of the operations that were not committed yet.
+func (r *registry) pendingPaths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := []string{}
+
+	for _, t := range r.ops {
+		switch t.op.Stage {
+		case "pending", "queue", "add":
+			for _, p := range t.op.paths {
+				paths = append(paths, path.Clean(p))
+			}
+		}
+	}
+
+	return paths
+}
+
+// pendingAuthors returns the paths of the operations not committed yet, with the email of the author
+// of the newest operation changing each of them, or an empty one for the server.
+func (r *registry) pendingAuthors() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int64, 0, len(r.ops))
+
+	for id := range r.ops {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+	authors := map[string]string{}
+
+	for _, id := range ids {
+		t := r.ops[id]
+
+		switch t.op.Stage {
+		case "pending", "queue", "add":
+			for _, p := range t.op.paths {
+				authors[path.Clean(p)] = t.cmd.author.email()
+			}
+		}
+	}
+
+	return authors
+}
+
+// record appends the operation's state to the journal, compacting it once it holds
+// JOURNAL_COMPACT_EVERY records more than the operations it describes. It must be called with mu held.
+func (r *registry) record(t *tracked, done bool) {
+	if r.journal == nil {
+		return
+	}
+
+	if err := r.journal.append(newEntry(t.cmd, &t.op, done)); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if r.journal.records < len(r.ops)+len(r.done)+JOURNAL_COMPACT_EVERY {
+		return
+	}
+
+	entries := make([]journalEntry, 0, len(r.ops)+len(r.done))
+
+	for _, e := range r.done {
+		entries = append(entries, e)
+	}
+
+	for _, t := range r.ops {
+		entries = append(entries, newEntry(t.cmd, &t.op, false))
+	}
+
+	slices.SortFunc(entries, func(a, b journalEntry) int { return cmp.Compare(a.Id, b.Id) })
+
+	if err := r.journal.compact(entries); err != nil {
+		log.Println(err)
+	}
+}
+
+// broadcast sends a copy of the operation to every listener. A listener that fell behind
+// loses its oldest update rather than blocking the client, so it always receives the latest state.
+func (t *tracked) broadcast() {
+	for _, c := range t.listeners {
+		op := t.op.copy()
+
+		select {
+		case c <- op:
+		default:
+			select {
+			case <-c:
+			default:
+			}
+			c <- op
+		}
+	}
+}
+
+func (op *Operation) copy() *Operation {
+	c := *op
+	c.Conflicts = slices.Clone(op.Conflicts)
+	return &c
+}
+
+func mapKeys[K comparable, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
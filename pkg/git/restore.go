@@ -0,0 +1,81 @@
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Restore brings the file or folder at p back to its content in revision rev, as a single commit, before returning.
+// Files added under p since rev are kept. It fails with fs.ErrNotExist if rev has no p, with fs.ErrExist if p
+// already holds that content, with ErrLocked if p is locked by someone other than author, and with the error
+// of quota if the restored content does not fit. If a file cannot be restored, the files already restored are put back.
+// It returns the commit operation ID. The commit is attributed to author, or to the server if nil.
+func (gfs *GitFileSystem) Restore(rev, p string, author *Author, quota QuotaCheck) (int64, error) {
+	p = strings.Trim(path.Join("/", p), "/")
+
+	return gfs.Processor.change(func() (int64, error) { return gfs.restore(rev, p, author, quota) })
+}
+
+func (gfs *GitFileSystem) restore(rev, p string, author *Author, quota QuotaCheck) (int64, error) {
+	gc := gfs.Processor
+	b := newBatch(gfs)
+	defer os.RemoveAll(b.trash)
+
+	if err := gfs.checkLock(p, author.email()); err != nil {
+		return -1, err
+	}
+
+	if err := b.check(p); err != nil {
+		return -1, err
+	}
+
+	files, err := gc.filesAt(rev, p)
+
+	if err != nil {
+		return -1, err
+	}
+
+	var delta Usage
+	changed := files[:0]
+
+	for _, f := range files {
+		if h, err := gfs.BlobHash(f.Name); err == nil && h == f.Hash.String() {
+			continue
+		}
+
+		changed = append(changed, f)
+		delta = delta.Add(Usage{Size: f.Size, Files: 1})
+
+		if info, err := os.Lstat(b.abs(f.Name)); err == nil && !info.IsDir() {
+			delta = delta.Add(Usage{Size: -info.Size(), Files: -1})
+		}
+	}
+
+	if len(changed) == 0 {
+		return -1, fmt.Errorf("\"%v\" is already as in %v: %w", p, rev, fs.ErrExist)
+	}
+
+	if err := gc.checkQuota(quota, delta); err != nil {
+		return -1, err
+	}
+
+	cmd := gc.begin(fmt.Sprintf("restore: %v from %v", p, rev), []string{p}, &CommitOptions{Author: author})
+
+	for _, f := range changed {
+		if err := b.restore(f); err != nil {
+			b.rollback()
+			err = fmt.Errorf("failed to restore \"%v\": %w", f.Name, err)
+			gc.abort(cmd, err)
+			return -1, err
+		}
+	}
+
+	if err := b.commit(cmd); err != nil {
+		return -1, fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	return cmd.id, nil
+}
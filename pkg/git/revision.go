@@ -0,0 +1,240 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// entryInfo implements fs.FileInfo for a tree entry read from the object store.
+type entryInfo struct {
+	name  string
+	size  int64
+	mode  filemode.FileMode
+	mtime time.Time
+}
+
+func (e *entryInfo) Name() string       { return e.name }
+func (e *entryInfo) Size() int64        { return e.size }
+func (e *entryInfo) ModTime() time.Time { return e.mtime }
+func (e *entryInfo) IsDir() bool        { return e.mode == filemode.Dir }
+func (e *entryInfo) Sys() any           { return nil }
+
+func (e *entryInfo) Mode() fs.FileMode {
+	m, err := e.mode.ToOSFileMode()
+
+	if err != nil {
+		return 0
+	}
+
+	return m
+}
+
+// ResolveRevision resolves a revision, such as a commit hash or a branch name, to a commit hash.
+// Branches only known on the remote resolve by their bare name too.
+func (gc *GitClient) ResolveRevision(rev string) (string, error) {
+	return call(gc, func() (string, error) {
+		h, err := gc.resolve(rev)
+
+		if err != nil {
+			return "", err
+		}
+
+		return h.String(), nil
+	})
+}
+
+func (gc *GitClient) resolve(rev string) (*plumbing.Hash, error) {
+	h, err := gc.repo.ResolveRevision(plumbing.Revision(rev))
+
+	if err != nil {
+		if rh, rerr := gc.repo.ResolveRevision(plumbing.Revision(plumbing.NewRemoteReferenceName(gc.remote, rev))); rerr == nil {
+			return rh, nil
+		}
+
+		return nil, fmt.Errorf("failed to resolve revision \"%v\": %w", rev, fs.ErrNotExist)
+	}
+
+	return h, nil
+}
+
+func (gc *GitClient) treeAt(rev string) (*object.Commit, *object.Tree, error) {
+	h, err := gc.resolve(rev)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := gc.repo.CommitObject(*h)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := c.Tree()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, t, nil
+}
+
+// StatAt returns the fs.FileInfo of the path p as it was in revision rev.
+func (gc *GitClient) StatAt(rev, p string) (fs.FileInfo, error) {
+	return call(gc, func() (fs.FileInfo, error) { return gc.statAt(rev, p) })
+}
+
+func (gc *GitClient) statAt(rev, p string) (fs.FileInfo, error) {
+	c, t, err := gc.treeAt(rev)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p = strings.Trim(path.Clean("/"+p), "/")
+
+	if p == "" {
+		return &entryInfo{"", 0, filemode.Dir, c.Committer.When}, nil
+	}
+
+	e, err := t.FindEntry(p)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find \"%v\" at %v: %w", p, rev, fs.ErrNotExist)
+	}
+
+	info := &entryInfo{e.Name, 0, e.Mode, c.Committer.When}
+
+	if !info.IsDir() {
+		if info.size, err = t.Size(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// ReadDirAt reads the directory p as it was in revision rev, without touching the worktree.
+func (gc *GitClient) ReadDirAt(rev, p string) ([]fs.FileInfo, error) {
+	return call(gc, func() ([]fs.FileInfo, error) { return gc.readDirAt(rev, p) })
+}
+
+func (gc *GitClient) readDirAt(rev, p string) ([]fs.FileInfo, error) {
+	c, t, err := gc.treeAt(rev)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p = strings.Trim(path.Clean("/"+p), "/"); p != "" {
+		if t, err = t.Tree(p); err != nil {
+			return nil, fmt.Errorf("failed to read directory \"%v\" at %v: %w", p, rev, fs.ErrNotExist)
+		}
+	}
+
+	infos := make([]fs.FileInfo, 0, len(t.Entries))
+
+	for _, e := range t.Entries {
+		info := &entryInfo{e.Name, 0, e.Mode, c.Committer.When}
+
+		if !info.IsDir() {
+			if info.size, err = t.Size(e.Name); err != nil {
+				return nil, err
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// ReadFileAt returns the content of the file p as it was in revision rev, without touching the worktree.
+func (gc *GitClient) ReadFileAt(rev, p string) (b []byte, info fs.FileInfo, err error) {
+	err = gc.do(func() error {
+		b, info, err = gc.readFileAt(rev, p)
+		return err
+	})
+
+	return b, info, err
+}
+
+func (gc *GitClient) readFileAt(rev, p string) ([]byte, fs.FileInfo, error) {
+	c, t, err := gc.treeAt(rev)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p = strings.Trim(path.Clean("/"+p), "/")
+	f, err := t.File(p)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read \"%v\" at %v: %w", p, rev, fs.ErrNotExist)
+	}
+
+	r, err := f.Reader()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b, &entryInfo{path.Base(p), f.Size, f.Mode, c.Committer.When}, nil
+}
+
+// filesAt returns the files at p, or under it if it is a directory, as they were in revision rev,
+// named relative to the repository root. It must run on the processing goroutine.
+func (gc *GitClient) filesAt(rev, p string) ([]*object.File, error) {
+	_, t, err := gc.treeAt(rev)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := t.FindEntry(p)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find \"%v\" at %v: %w", p, rev, fs.ErrNotExist)
+	}
+
+	if e.Mode != filemode.Dir {
+		f, err := t.File(p)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []*object.File{f}, nil
+	}
+
+	sub, err := t.Tree(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*object.File{}
+
+	err = sub.Files().ForEach(func(f *object.File) error {
+		f.Name = path.Join(p, f.Name)
+		files = append(files, f)
+		return nil
+	})
+
+	return files, err
+}
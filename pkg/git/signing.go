@@ -0,0 +1,475 @@
+package git
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SIGN_NONE    = ""        // Commits are not signed.
+	SIGN_OPENPGP = "openpgp" // Armored OpenPGP private key.
+	SIGN_SSH     = "ssh"     // SSH private key, signing in the format of git's gpg.format=ssh.
+)
+
+// SSHSIG_NAMESPACE is the namespace git uses for SSH commit signatures.
+const SSHSIG_NAMESPACE = "git"
+
+const sshsigMagic = "SSHSIG"
+const sshsigArmorStart = "-----BEGIN SSH SIGNATURE-----"
+const sshsigArmorEnd = "-----END SSH SIGNATURE-----"
+const pgpArmorStart = "-----BEGIN PGP SIGNATURE-----"
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// SigningConfig describes the key the server signs its commits with.
+type SigningConfig struct {
+	Method string // Method is one of SIGN_NONE, SIGN_OPENPGP or SIGN_SSH.
+	Key    string // Key is the path of the private key.
+	Secret string // Secret is the passphrase of the key, if encrypted.
+}
+
+// Signer signs commits with the server's OpenPGP or SSH key and verifies signatures against it.
+type Signer struct {
+	method string
+	pgp    *openpgp.Entity
+	ssh    ssh.Signer
+}
+
+// Verification reports whether a commit is signed and whether the signature belongs to the server.
+type Verification struct {
+	Signed   bool   `json:"signed"`
+	Method   string `json:"method,omitempty"` // Method is SIGN_OPENPGP or SIGN_SSH, as read from the signature.
+	Verified bool   `json:"verified"`         // Verified is set if the signature is valid for the server's signing key.
+}
+
+// Signer loads the signing key. SIGN_NONE returns a nil signer.
+func (c SigningConfig) Signer() (*Signer, error) {
+	if c.Method == SIGN_NONE {
+		return nil, nil
+	}
+
+	if c.Key == "" {
+		return nil, fmt.Errorf("%v signing needs a private key: %w", c.Method, ErrMissingCredential)
+	}
+
+	b, err := os.ReadFile(c.Key)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key \"%v\": %w", c.Key, err)
+	}
+
+	switch c.Method {
+	case SIGN_OPENPGP:
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key \"%v\": %w", c.Key, err)
+		}
+
+		if len(entities) == 0 || entities[0].PrivateKey == nil {
+			return nil, fmt.Errorf("signing key \"%v\" has no private key: %w", c.Key, ErrMissingCredential)
+		}
+
+		e := entities[0]
+
+		if e.PrivateKey.Encrypted {
+			if err := e.DecryptPrivateKeys([]byte(c.Secret)); err != nil {
+				return nil, fmt.Errorf("failed to decrypt signing key \"%v\": %w", c.Key, err)
+			}
+		}
+
+		return &Signer{method: SIGN_OPENPGP, pgp: e}, nil
+	case SIGN_SSH:
+		var s ssh.Signer
+
+		if c.Secret != "" {
+			s, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(c.Secret))
+		} else {
+			s, err = ssh.ParsePrivateKey(b)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key \"%v\": %w", c.Key, err)
+		}
+
+		return &Signer{method: SIGN_SSH, ssh: s}, nil
+	default:
+		return nil, fmt.Errorf("unknown signing method \"%v\"", c.Method)
+	}
+}
+
+// Verify checks the signature of payload against the server's key.
+func (s *Signer) Verify(payload []byte, signature string) error {
+	switch {
+	case strings.HasPrefix(signature, pgpArmorStart) && s.method == SIGN_OPENPGP:
+		_, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{s.pgp}, bytes.NewReader(payload), strings.NewReader(signature), nil)
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+
+		return nil
+	case strings.HasPrefix(signature, sshsigArmorStart) && s.method == SIGN_SSH:
+		return s.verifySSH(payload, signature)
+	default:
+		return fmt.Errorf("signature is not made with the server's %v key: %w", s.method, ErrInvalidSignature)
+	}
+}
+
+// sshsigSigned is the data an SSH signature is computed over, after the magic preamble.
+type sshsigSigned struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// sshsigBlob is an SSH signature, after the magic preamble.
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+func sshsigHash(algorithm string, payload []byte) ([]byte, error) {
+	var h hash.Hash
+
+	switch algorithm {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm \"%v\": %w", algorithm, ErrInvalidSignature)
+	}
+
+	h.Write(payload)
+
+	return h.Sum(nil), nil
+}
+
+func sshsigData(algorithm string, payload []byte) ([]byte, error) {
+	sum, err := sshsigHash(algorithm, payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(sshsigMagic), ssh.Marshal(sshsigSigned{SSHSIG_NAMESPACE, "", algorithm, sum})...), nil
+}
+
+func (s *Signer) signSSH(payload []byte) (string, error) {
+	data, err := sshsigData("sha512", payload)
+
+	if err != nil {
+		return "", err
+	}
+
+	var sig *ssh.Signature
+
+	if as, ok := s.ssh.(ssh.AlgorithmSigner); ok && s.ssh.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = s.ssh.Sign(rand.Reader, data)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	blob := append([]byte(sshsigMagic), ssh.Marshal(sshsigBlob{
+		Version:       1,
+		PublicKey:     s.ssh.PublicKey().Marshal(),
+		Namespace:     SSHSIG_NAMESPACE,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var armor strings.Builder
+	armor.WriteString(sshsigArmorStart + "\n")
+
+	for len(encoded) > 70 {
+		armor.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+
+	armor.WriteString(encoded + "\n" + sshsigArmorEnd + "\n")
+
+	return armor.String(), nil
+}
+
+func (s *Signer) verifySSH(payload []byte, signature string) error {
+	body := strings.TrimSpace(signature)
+	body = strings.TrimPrefix(body, sshsigArmorStart)
+	body = strings.TrimSuffix(body, sshsigArmorEnd)
+
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+
+	if err != nil || !bytes.HasPrefix(raw, []byte(sshsigMagic)) {
+		return fmt.Errorf("malformed ssh signature: %w", ErrInvalidSignature)
+	}
+
+	var blob sshsigBlob
+
+	if err := ssh.Unmarshal(raw[len(sshsigMagic):], &blob); err != nil {
+		return fmt.Errorf("malformed ssh signature: %w", ErrInvalidSignature)
+	}
+
+	pub := s.ssh.PublicKey()
+
+	if blob.Namespace != SSHSIG_NAMESPACE || !bytes.Equal(blob.PublicKey, pub.Marshal()) {
+		return fmt.Errorf("signature is not made with the server's ssh key: %w", ErrInvalidSignature)
+	}
+
+	data, err := sshsigData(blob.HashAlgorithm, payload)
+
+	if err != nil {
+		return err
+	}
+
+	var sig ssh.Signature
+
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return fmt.Errorf("malformed ssh signature: %w", ErrInvalidSignature)
+	}
+
+	if err := pub.Verify(data, &sig); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	return nil
+}
+
+// SignWith makes the client sign every commit it creates from now on with s.
+func (gc *GitClient) SignWith(s *Signer) {
+	gc.do(func() error {
+		gc.signer = s
+		return nil
+	})
+}
+
+// commitSigned commits the staged changes with opts and returns the hash of the commit, signed if the client
+// has a signer. The commit is signed before HEAD's branch moves to it, so a failure to sign leaves HEAD untouched.
+// OpenPGP commits are signed by go-git, SSH ones, which it does not support, by commitSSH.
+func (gc *GitClient) commitSigned(w *git.Worktree, message string, opts *git.CommitOptions) (plumbing.Hash, error) {
+	if gc.signer == nil {
+		return w.Commit(message, opts)
+	}
+
+	if gc.signer.method == SIGN_OPENPGP {
+		opts.SignKey = gc.signer.pgp
+		return w.Commit(message, opts)
+	}
+
+	return gc.commitSSH(message, opts)
+}
+
+// commitSSH builds the commit of the staged index like Worktree.Commit, signs it with the SSH key, and only then
+// writes its objects and moves HEAD's branch to it. opts must set the author and the committer.
+func (gc *GitClient) commitSSH(message string, opts *git.CommitOptions) (plumbing.Hash, error) {
+	idx, err := gc.repo.Storer.Index()
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	objects := []plumbing.EncodedObject{}
+	tree, err := buildTree(idx.Entries, "", &objects)
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parents := opts.Parents
+	head, err := gc.repo.Head()
+
+	if err == nil && len(parents) == 0 {
+		parents = []plumbing.Hash{head.Hash()}
+	} else if err != nil && err != plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, err
+	}
+
+	if !opts.AllowEmptyCommits && len(parents) > 0 {
+		parent, err := gc.repo.CommitObject(parents[0])
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if parent.TreeHash == tree {
+			return plumbing.ZeroHash, git.ErrEmptyCommit
+		}
+	}
+
+	c := &object.Commit{
+		Author:       *opts.Author,
+		Committer:    *opts.Committer,
+		Message:      message,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+
+	payload, err := commitPayload(c)
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if c.PGPSignature, err = gc.signer.signSSH(payload); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to sign commit: %w", err)
+	}
+
+	obj := gc.repo.Storer.NewEncodedObject()
+
+	if err := c.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, o := range append(objects, obj) {
+		if _, err := gc.repo.Storer.SetEncodedObject(o); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	ref, err := gc.repo.Storer.Reference(plumbing.HEAD)
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	name := plumbing.HEAD
+
+	if ref.Type() == plumbing.SymbolicReference {
+		name = ref.Target()
+	}
+
+	return obj.Hash(), gc.repo.Storer.SetReference(plumbing.NewHashReference(name, obj.Hash()))
+}
+
+// buildTree encodes the tree of the index entries under dir, and of its subdirectories, appending them to objects
+// without writing them. Entries must be sorted by name, as they are in the index. It returns the hash of the tree.
+func buildTree(entries []*index.Entry, dir string, objects *[]plumbing.EncodedObject) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	prefix := ""
+
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	for i := 0; i < len(entries); {
+		name := strings.TrimPrefix(entries[i].Name, prefix)
+		sub, _, isDir := strings.Cut(name, "/")
+
+		if !isDir {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: entries[i].Mode, Hash: entries[i].Hash})
+			i++
+			continue
+		}
+
+		j := i
+
+		for j < len(entries) && strings.HasPrefix(entries[j].Name, prefix+sub+"/") {
+			j++
+		}
+
+		h, err := buildTree(entries[i:j], prefix+sub, objects)
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: sub, Mode: filemode.Dir, Hash: h})
+		i = j
+	}
+
+	// git sorts tree entries by name, directories as if their name ended with a slash
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+
+	slices.SortFunc(tree.Entries, func(a, b object.TreeEntry) int { return strings.Compare(sortName(a), sortName(b)) })
+
+	obj := &plumbing.MemoryObject{}
+
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	*objects = append(*objects, obj)
+
+	return obj.Hash(), nil
+}
+
+// verify reports the signature state of c against the client's signer.
+func (gc *GitClient) verify(c *object.Commit) Verification {
+	v := Verification{Signed: c.PGPSignature != ""}
+
+	if !v.Signed {
+		return v
+	}
+
+	if strings.HasPrefix(c.PGPSignature, sshsigArmorStart) {
+		v.Method = SIGN_SSH
+	} else if strings.HasPrefix(c.PGPSignature, pgpArmorStart) {
+		v.Method = SIGN_OPENPGP
+	}
+
+	if gc.signer == nil {
+		return v
+	}
+
+	payload, err := commitPayload(c)
+
+	v.Verified = err == nil && gc.signer.Verify(payload, c.PGPSignature) == nil
+
+	return v
+}
+
+// commitPayload encodes c without its signature, which is the content a commit signature covers.
+func commitPayload(c *object.Commit) ([]byte, error) {
+	obj := &plumbing.MemoryObject{}
+
+	if err := c.EncodeWithoutSignature(obj); err != nil {
+		return nil, err
+	}
+
+	r, err := obj.Reader()
+
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
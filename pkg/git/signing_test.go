@@ -0,0 +1,143 @@
+package git_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/prxg22/git-drive/internal/testutil"
+	"github.com/prxg22/git-drive/pkg/git"
+	"golang.org/x/crypto/ssh"
+)
+
+func writeSSHKey(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p := path.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(p, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return p
+}
+
+func writePGPKey(t *testing.T) string {
+	t.Helper()
+
+	e, err := openpgp.NewEntity("drive", "", "drive@example.com", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	p := path.Join(t.TempDir(), "key.asc")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	w, err := armor.Encode(f, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := e.SerializePrivate(w, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return p
+}
+
+func TestClientSigned(t *testing.T) {
+	keys := map[string]string{
+		git.SIGN_SSH:     writeSSHKey(t),
+		git.SIGN_OPENPGP: writePGPKey(t),
+	}
+
+	for method, key := range keys {
+		s, err := git.SigningConfig{Method: method, Key: key}.Signer()
+		if err != nil {
+			t.Fatalf("Unexpected %v error: %v", method, err)
+		}
+
+		testutil.WithIdentity(t)
+		url := testutil.NewRemote(t, map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "c", "dir.txt": "d"})
+
+		gc := newClient(t, url, "", testutil.LocalPath(t))
+		gc.PullEvery(time.Hour)
+		gc.SignWith(s)
+
+		for p, content := range map[string]string{"dir/sub/c.txt": "signed", "dir/new/e.txt": "e"} {
+			if err := os.MkdirAll(path.Dir(path.Join(gc.Path, p)), 0o755); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := os.WriteFile(path.Join(gc.Path, p), []byte(content), 0o644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		id, err := gc.Commit("edit", []string{"dir/sub/c.txt", "dir/new/e.txt"}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if op := waitOperation(t, gc, id); op.Status != "success" {
+			t.Fatalf("Expected success, got %+v", op)
+		}
+
+		history, err := gc.History("/", 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if v := history[0].Signature; !v.Signed || !v.Verified || v.Method != method {
+			t.Errorf("Expected a verified %v signature, got %+v", method, v)
+		}
+
+		repo, _ := gogit.PlainOpen(gc.Path)
+		w, _ := repo.Worktree()
+		if status, _ := w.Status(); !status.IsClean() {
+			t.Errorf("Expected the %v commit to hold the staged tree, got status %v", method, status)
+		}
+
+		head, _ := repo.Head()
+		c, _ := repo.CommitObject(head.Hash())
+		if c.Hash.String() != history[0].Hash || c.NumParents() != 1 {
+			t.Errorf("Expected HEAD to be the signed commit %v, got %v", history[0].Hash, c.Hash)
+		}
+		if err := s.Verify([]byte("tampered"), c.PGPSignature); !errors.Is(err, git.ErrInvalidSignature) {
+			t.Errorf("Expected ErrInvalidSignature for a tampered %v payload, got %v", method, err)
+		}
+	}
+}
+
+func TestSignerNone(t *testing.T) {
+	s, err := git.SigningConfig{}.Signer()
+	if err != nil || s != nil {
+		t.Errorf("Expected no signer, got %v, %v", s, err)
+	}
+
+	if _, err := (git.SigningConfig{Method: git.SIGN_SSH}).Signer(); !errors.Is(err, git.ErrMissingCredential) {
+		t.Errorf("Expected ErrMissingCredential, got %v", err)
+	}
+}
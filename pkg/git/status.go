@@ -0,0 +1,57 @@
+package git
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// RemoteStatus reports whether the drive can reach its remote. While it cannot, the drive keeps committing
+// locally and its operations wait for the push as "committed", catching up once the remote is back.
+type RemoteStatus struct {
+	Online   bool      `json:"online"`
+	Error    string    `json:"error,omitempty"` // Error is the last failure reaching the remote.
+	Since    time.Time `json:"since"`           // Since is when the remote became reachable or unreachable.
+	Unpushed int       `json:"unpushed"`        // Unpushed counts the committed operations awaiting push.
+}
+
+// RemoteStatus returns the reachability of the remote, as seen by the last fetch or push.
+func (gc *GitClient) RemoteStatus() RemoteStatus {
+	s := *gc.health.Load()
+
+	gc.ops.each(func(id int64, op *Operation) bool {
+		if op.Stage == "commit" || op.Stage == "push" {
+			s.Unpushed++
+		}
+		return false
+	})
+
+	return s
+}
+
+// reached records the outcome of an exchange with the remote. Errors returned by a remote that answered,
+// such as a rejected update, leave it online.
+func (gc *GitClient) reached(err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, git.NoErrAlreadyUpToDate), errors.Is(err, git.ErrUnstagedChanges):
+		err = nil
+	case strings.HasPrefix(err.Error(), git.ErrNonFastForwardUpdate.Error()):
+		err = nil
+	}
+
+	prev := gc.health.Load()
+	s := &RemoteStatus{Online: err == nil, Since: prev.Since}
+
+	if s.Online != prev.Online {
+		s.Since = time.Now()
+	}
+
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	gc.health.Store(s)
+}
@@ -0,0 +1,244 @@
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Usage describes the storage used by files.
+type Usage struct {
+	Size  int64 `json:"size"`  // Size is the sum of the files' sizes in bytes.
+	Files int64 `json:"files"` // Files is the number of files.
+}
+
+// Add returns the sum of both usages.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{Size: u.Size + o.Size, Files: u.Files + o.Files}
+}
+
+// QuotaCheck decides whether a change adding delta to the usage may go ahead, given the usage before it,
+// including the changes not committed yet. It runs on the processing goroutine along with the change,
+// so concurrent changes are checked one after the other, and must not call the client.
+type QuotaCheck func(delta, total Usage, authors map[string]Usage) error
+
+type usageCache struct {
+	head   plumbing.Hash
+	sizes  map[string]int64  // blob size of every file in HEAD's tree
+	owners map[string]string // email of the author charged for every file in HEAD's tree
+}
+
+// Usage computes the storage used by the files in HEAD's tree and by the changes of the operations not committed yet,
+// as it will be once they are.
+// It returns the total usage and the usage per author email, where each file is attributed
+// to the author of the last commit or operation that changed it.
+// Committed usage is cached until HEAD moves.
+func (gc *GitClient) Usage() (total Usage, authors map[string]Usage, err error) {
+	err = gc.do(func() error {
+		total, authors, err = gc.computeUsage()
+		return err
+	})
+
+	return total, authors, err
+}
+
+// checkQuota runs check, if any, against the current usage. It must run on the processing goroutine.
+func (gc *GitClient) checkQuota(check QuotaCheck, delta Usage) error {
+	if check == nil {
+		return nil
+	}
+
+	total, authors, err := gc.computeUsage()
+
+	if err != nil {
+		return err
+	}
+
+	return check(delta, total, authors)
+}
+
+func (gc *GitClient) computeUsage() (Usage, map[string]Usage, error) {
+	committed, err := gc.committedUsage()
+
+	if err != nil {
+		return Usage{}, nil, err
+	}
+
+	sizes := maps.Clone(committed.sizes)
+	owners := maps.Clone(committed.owners)
+
+	for p, email := range gc.ops.pendingAuthors() {
+		if email == "" {
+			email = gc.identity().Email
+		}
+
+		for f := range sizes {
+			if f == p || strings.HasPrefix(f, p+"/") {
+				delete(sizes, f)
+				delete(owners, f)
+			}
+		}
+
+		err := filepath.WalkDir(path.Join(gc.Path, p), func(fp string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			info, err := d.Info()
+
+			if err != nil {
+				return err
+			}
+
+			f := strings.TrimPrefix(fp, gc.Path+"/")
+			sizes[f] = info.Size()
+			owners[f] = email
+
+			return nil
+		})
+
+		if err != nil {
+			return Usage{}, nil, err
+		}
+	}
+
+	var total Usage
+	authors := make(map[string]Usage)
+
+	for f, size := range sizes {
+		total = total.Add(Usage{Size: size, Files: 1})
+		authors[owners[f]] = authors[owners[f]].Add(Usage{Size: size, Files: 1})
+	}
+
+	return total, authors, nil
+}
+
+// committedUsage returns the size and the author charged for every file in HEAD's tree, cached until HEAD moves.
+func (gc *GitClient) committedUsage() (*usageCache, error) {
+	ref, err := gc.repo.Head()
+
+	if err == plumbing.ErrReferenceNotFound {
+		return &usageCache{sizes: map[string]int64{}, owners: map[string]string{}}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	if c := gc.usage; c != nil && c.head == ref.Hash() {
+		return c, nil
+	}
+
+	head, err := gc.repo.CommitObject(ref.Hash())
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := head.Tree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		sizes[f.Name] = f.Size
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	owners, err := gc.attribute(ref.Hash(), sizes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gc.usage = &usageCache{ref.Hash(), sizes, owners}
+
+	return gc.usage, nil
+}
+
+// attribute walks the history from head and charges every path in sizes
+// to the author of the newest commit that changed it. It returns the author's email by path.
+func (gc *GitClient) attribute(head plumbing.Hash, sizes map[string]int64) (map[string]string, error) {
+	owners := make(map[string]string, len(sizes))
+
+	iter, err := gc.repo.Log(&git.LogOptions{From: head})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = iter.ForEach(func(c *object.Commit) error {
+		if len(owners) == len(sizes) {
+			return storer.ErrStop
+		}
+
+		paths, err := changedPaths(c)
+
+		if err != nil {
+			return err
+		}
+
+		for _, p := range paths {
+			if _, ok := sizes[p]; ok {
+				if _, charged := owners[p]; !charged {
+					owners[p] = c.Author.Email
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return owners, err
+}
+
+// usage sums the size and number of the files at p, or under it, in the worktree.
+func (gfs *GitFileSystem) usage(p string) (Usage, error) {
+	var usage Usage
+
+	err := filepath.WalkDir(path.Join(gfs.Path, path.Join("/", p)), func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		usage = usage.Add(Usage{Size: info.Size(), Files: 1})
+
+		return nil
+	})
+
+	return usage, err
+}
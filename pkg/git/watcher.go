@@ -0,0 +1,97 @@
+package git
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Watch starts watching the worktree for changes made outside the drive, such as scripts or an rsync into the clone.
+// Once no change is seen for debounce, the dirty paths that no pending operation owns are committed
+// with an "external:" message.
+func (gc *GitClient) Watch(debounce time.Duration) error {
+	events, err := gc.watch(debounce)
+
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-events:
+				timer.Reset(debounce)
+			case <-timer.C:
+				if err := gc.commitExternal(); err != nil {
+					log.Println(err)
+				}
+			case <-gc.stopped:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// commitExternal commits the worktree changes that were not made through the drive.
+// The dirty paths are read and their operation registered in the same call on the processing goroutine,
+// so a change of the drive cannot start on them in between.
+func (gc *GitClient) commitExternal() error {
+	_, err := gc.change(func() (int64, error) {
+		paths, err := gc.externalPaths()
+
+		if err != nil || len(paths) == 0 {
+			return -1, err
+		}
+
+		cmd := gc.begin("external: "+strings.Join(paths, " | "), paths, nil)
+		gc.submit(cmd)
+
+		return cmd.id, nil
+	})
+
+	return err
+}
+
+// externalPaths returns the dirty paths of the worktree that no pending operation owns, sorted.
+func (gc *GitClient) externalPaths() ([]string, error) {
+	w, err := gc.repo.Worktree()
+
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := w.Status()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pending := gc.ops.pendingPaths()
+	paths := []string{}
+
+	for p, s := range status {
+		if s.Worktree == git.Unmodified && s.Staging == git.Unmodified {
+			continue
+		}
+
+		owned := slices.ContainsFunc(pending, func(pp string) bool {
+			return p == pp || strings.HasPrefix(p, pp+"/")
+		})
+
+		if !owned {
+			paths = append(paths, p)
+		}
+	}
+
+	slices.Sort(paths)
+
+	return paths, nil
+}
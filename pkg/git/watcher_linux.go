@@ -0,0 +1,117 @@
+//go:build linux
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const WATCH_MASK = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+
+// watch signals every inotify event on the worktree, excluding the ".git" directory.
+// Directories created after the watch started are watched as well. The watch ends once the client stopped.
+func (gc *GitClient) watch(_ time.Duration) (<-chan struct{}, error) {
+	// non-blocking, so reads go through the runtime poller and closing the file interrupts them
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+
+	dirs := make(map[int32]string)
+
+	add := func(root string) error {
+		return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() {
+				return nil
+			}
+
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			wd, err := unix.InotifyAddWatch(fd, p, WATCH_MASK)
+
+			if err != nil {
+				return fmt.Errorf("failed to watch \"%v\": %w", p, err)
+			}
+
+			dirs[int32(wd)] = p
+			return nil
+		})
+	}
+
+	if err := add(gc.Path); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	events := make(chan struct{}, 1)
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	go func() {
+		<-gc.stopped
+		f.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+		for {
+			n, err := f.Read(buf)
+
+			if errors.Is(err, os.ErrClosed) {
+				return
+			} else if err != nil {
+				log.Println(fmt.Errorf("watcher stopped: %w", err))
+				f.Close()
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				name := strings.TrimRight(string(buf[offset+unix.SizeofInotifyEvent:offset+unix.SizeofInotifyEvent+int(ev.Len)]), "\x00")
+				offset += unix.SizeofInotifyEvent + int(ev.Len)
+
+				if ev.Mask&unix.IN_IGNORED != 0 {
+					delete(dirs, ev.Wd)
+					continue
+				}
+
+				dir, ok := dirs[ev.Wd]
+
+				if !ok || name == ".git" {
+					continue
+				}
+
+				if ev.Mask&unix.IN_ISDIR != 0 && ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+					if err := add(path.Join(dir, name)); err != nil {
+						log.Println(err)
+					}
+				}
+
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
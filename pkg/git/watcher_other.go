@@ -0,0 +1,32 @@
+//go:build !linux
+
+package git
+
+import (
+	"time"
+)
+
+// watch polls the worktree where inotify is not available.
+// Polls are twice the debounce interval apart so the debounce timer can fire between them. The watch ends once the client stopped.
+func (gc *GitClient) watch(interval time.Duration) (<-chan struct{}, error) {
+	events := make(chan struct{}, 1)
+
+	go func() {
+		t := time.NewTicker(2 * interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			case <-gc.stopped:
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
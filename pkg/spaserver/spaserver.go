@@ -1,6 +1,7 @@
 package spaserver
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -21,8 +22,25 @@ func NewSPAServer(r *Routes, routePrefix, fileServerPath string) *SPAServer {
 	return &SPAServer{r, mu}
 }
 
-func (s *SPAServer) Listen(port string) {
-	http.ListenAndServe(port, s.mu)
+// Listen serves on port until ctx is done. It then stops accepting connections and waits until shutdown is done
+// for the requests in flight to finish, so handlers of long-lived streams must end on ctx themselves.
+func (s *SPAServer) Listen(ctx, shutdown context.Context, port string) error {
+	srv := &http.Server{Addr: port, Handler: s.mu}
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("shutting down the server")
+
+	return srv.Shutdown(shutdown)
 }
 
 func routes(mu *http.ServeMux, r *Routes, px, sp string) {